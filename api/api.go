@@ -0,0 +1,108 @@
+// Package api implements the local control API. It exposes the operations on instances over HTTP on a
+// Unix socket in the config directory, so editors and scripts don't need to drive tmux directly.
+package api
+
+import (
+	"claude-squad/config"
+	"claude-squad/session"
+	"claude-squad/session/git"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// SocketFileName is the name of the control API socket in the config directory.
+const SocketFileName = "api.sock"
+
+// SocketPath returns the path of the control API socket.
+func SocketPath() (string, error) {
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get config directory: %w", err)
+	}
+	return filepath.Join(configDir, SocketFileName), nil
+}
+
+// InstanceInfo describes a stored instance.
+type InstanceInfo struct {
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	Branch       string    `json:"branch"`
+	Status       string    `json:"status"`
+	LostReason   string    `json:"lost_reason,omitempty"`
+	Program      string    `json:"program"`
+	AutoYes      bool      `json:"auto_yes"`
+	RepoPath     string    `json:"repo_path"`
+	WorktreePath string    `json:"worktree_path"`
+	Added        int       `json:"added"`
+	Removed      int       `json:"removed"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// NewInstanceInfo creates an InstanceInfo from serialized instance data.
+func NewInstanceInfo(data session.InstanceData) InstanceInfo {
+	return InstanceInfo{
+		ID:           data.ID,
+		Title:        data.Title,
+		Branch:       data.Branch,
+		Status:       data.Status.String(),
+		LostReason:   data.LostReason,
+		Program:      data.Program,
+		AutoYes:      data.AutoYes,
+		RepoPath:     data.Worktree.RepoPath,
+		WorktreePath: data.Worktree.WorktreePath,
+		Added:        data.DiffStats.Added,
+		Removed:      data.DiffStats.Removed,
+		CreatedAt:    data.CreatedAt,
+		UpdatedAt:    data.UpdatedAt,
+	}
+}
+
+// InstanceDiff holds the changes made by an instance since its base commit.
+type InstanceDiff struct {
+	ID            string              `json:"id"`
+	Title         string              `json:"title"`
+	Branch        string              `json:"branch"`
+	BaseCommitSHA string              `json:"base_commit_sha"`
+	Added         int                 `json:"added"`
+	Removed       int                 `json:"removed"`
+	Files         []git.FileDiffStats `json:"files"`
+	Patch         string              `json:"patch"`
+}
+
+// CreateRequest is the body of a request to create an instance.
+type CreateRequest struct {
+	Title string `json:"title"`
+	// Program defaults to the program the server was started with.
+	Program string `json:"program"`
+	// Path is a path within the git repository. Defaults to the directory the server was started in.
+	Path string `json:"path"`
+	// Base is the branch, tag or commit to start from. Defaults to HEAD.
+	Base string `json:"base"`
+	// Prompt is sent once the program is ready.
+	Prompt  string `json:"prompt"`
+	AutoYes bool   `json:"auto_yes"`
+}
+
+// PromptRequest is the body of a request to send a prompt to an instance.
+type PromptRequest struct {
+	Prompt string `json:"prompt"`
+	// WaitReady makes the request block until the instance is ready for input again.
+	WaitReady bool `json:"wait_ready"`
+}
+
+// RenameRequest is the body of a request to change the title of an instance.
+type RenameRequest struct {
+	Title string `json:"title"`
+}
+
+// PreviewResponse holds the captured content of an instance's pane.
+type PreviewResponse struct {
+	Content string `json:"content"`
+}
+
+// ErrorResponse is returned with any non-2xx status code.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
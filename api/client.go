@@ -0,0 +1,17 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+// NewHTTPClient returns an HTTP client which sends every request to the control API socket at path,
+// whatever the host in the URL.
+func NewHTTPClient(path string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+}
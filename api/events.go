@@ -0,0 +1,160 @@
+package api
+
+import (
+	"claude-squad/session"
+	"sort"
+	"time"
+)
+
+// EventType identifies the kind of change an Event reports.
+type EventType string
+
+const (
+	// EventCreated is emitted when an instance appears.
+	EventCreated EventType = "created"
+	// EventKilled is emitted when an instance disappears.
+	EventKilled EventType = "killed"
+	// EventStatus is emitted when the status of an instance changes.
+	EventStatus EventType = "status"
+	// EventPrompt is emitted when the program of an instance starts asking for approval.
+	EventPrompt EventType = "prompt"
+	// EventDiff is emitted when the diff stats of an instance change.
+	EventDiff EventType = "diff"
+)
+
+// Event is a change in the state of an instance. `cs watch` prints one per line.
+type Event struct {
+	Time  time.Time `json:"time"`
+	Type  EventType `json:"type"`
+	ID    string    `json:"id"`
+	Title string    `json:"title"`
+	// Status is the status of the instance after the change.
+	Status string `json:"status"`
+	// PreviousStatus is set for status events.
+	PreviousStatus string `json:"previous_status,omitempty"`
+	Added          int    `json:"added"`
+	Removed        int    `json:"removed"`
+}
+
+// Observation is the state of an instance as seen by one poll of a monitoring loop.
+type Observation struct {
+	Instance *session.Instance
+	// Data is observed instead of Instance for instances the host doesn't hold, e.g. the ones of other repos
+	// than the TUI lists. Their stored status and diff stats are reported.
+	Data *session.InstanceData
+	// Prompt is true if the program is waiting for approval.
+	Prompt bool
+}
+
+// snapshot returns the ID of the observed instance and the parts of the observation which are compared. ok is
+// false for instances which have not been started yet.
+func (o Observation) snapshot() (id string, snap instanceSnapshot, ok bool) {
+	if o.Data != nil {
+		return o.Data.ID, instanceSnapshot{
+			title:   o.Data.Title,
+			status:  o.Data.Status,
+			prompt:  o.Prompt,
+			added:   o.Data.DiffStats.Added,
+			removed: o.Data.DiffStats.Removed,
+		}, true
+	}
+	if !o.Instance.Started() {
+		return "", instanceSnapshot{}, false
+	}
+	snap = instanceSnapshot{title: o.Instance.Title, status: o.Instance.Status, prompt: o.Prompt}
+	if stats := o.Instance.GetDiffStats(); stats != nil {
+		snap.added, snap.removed = stats.Added, stats.Removed
+	}
+	return o.Instance.ID, snap, true
+}
+
+// instanceSnapshot holds the parts of an observation which are compared to derive events.
+type instanceSnapshot struct {
+	title   string
+	status  session.Status
+	prompt  bool
+	added   int
+	removed int
+}
+
+// EventTracker derives events by comparing successive observations of all instances.
+type EventTracker struct {
+	last map[string]instanceSnapshot
+	now  func() time.Time
+}
+
+// NewEventTracker creates an EventTracker. The first observation only establishes a baseline.
+func NewEventTracker() *EventTracker {
+	return &EventTracker{now: time.Now}
+}
+
+// Observe records the current state of all instances and returns the events since the last call.
+// Instances which have not been started yet are ignored.
+func (t *EventTracker) Observe(observations []Observation) []Event {
+	now := t.now()
+	current := make(map[string]instanceSnapshot, len(observations))
+	var events []Event
+	for _, o := range observations {
+		id, snap, ok := o.snapshot()
+		if !ok {
+			continue
+		}
+		current[id] = snap
+		if t.last == nil {
+			continue
+		}
+
+		event := Event{
+			Time:    now,
+			ID:      id,
+			Title:   snap.title,
+			Status:  snap.status.String(),
+			Added:   snap.added,
+			Removed: snap.removed,
+		}
+		prev, ok := t.last[id]
+		if !ok {
+			event.Type = EventCreated
+			events = append(events, event)
+			continue
+		}
+		if prev.status != snap.status {
+			e := event
+			e.Type = EventStatus
+			e.PreviousStatus = prev.status.String()
+			events = append(events, e)
+		}
+		if snap.prompt && !prev.prompt {
+			e := event
+			e.Type = EventPrompt
+			events = append(events, e)
+		}
+		if prev.added != snap.added || prev.removed != snap.removed {
+			e := event
+			e.Type = EventDiff
+			events = append(events, e)
+		}
+	}
+
+	var killed []string
+	for id := range t.last {
+		if _, ok := current[id]; !ok {
+			killed = append(killed, id)
+		}
+	}
+	sort.Strings(killed)
+	for _, id := range killed {
+		prev := t.last[id]
+		events = append(events, Event{
+			Time:    now,
+			Type:    EventKilled,
+			ID:      id,
+			Title:   prev.title,
+			Status:  prev.status.String(),
+			Added:   prev.added,
+			Removed: prev.removed,
+		})
+	}
+	t.last = current
+	return events
+}
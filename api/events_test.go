@@ -0,0 +1,36 @@
+package api
+
+import (
+	"claude-squad/session"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventTracker(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker := NewEventTracker()
+	tracker.now = func() time.Time { return now }
+
+	a := session.FromInstanceDataDetached(session.InstanceData{ID: "1", Title: "a", Status: session.Running})
+	b := session.FromInstanceDataDetached(session.InstanceData{ID: "2", Title: "b", Status: session.Ready})
+
+	// The first observation is the baseline.
+	assert.Empty(t, tracker.Observe([]Observation{{Instance: a}}))
+
+	a.SetStatus(session.Ready)
+	events := tracker.Observe([]Observation{{Instance: a, Prompt: true}, {Instance: b}})
+	assert.Equal(t, []Event{
+		{Time: now, Type: EventStatus, ID: "1", Title: "a", Status: "ready", PreviousStatus: "running"},
+		{Time: now, Type: EventPrompt, ID: "1", Title: "a", Status: "ready"},
+		{Time: now, Type: EventCreated, ID: "2", Title: "b", Status: "ready"},
+	}, events)
+
+	// A prompt which is still showing is not reported again, and renames keep the identity.
+	b.Title = "c"
+	assert.Empty(t, tracker.Observe([]Observation{{Instance: a, Prompt: true}, {Instance: b}}))
+
+	events = tracker.Observe([]Observation{{Instance: b}})
+	assert.Equal(t, []Event{{Time: now, Type: EventKilled, ID: "1", Title: "a", Status: "ready"}}, events)
+}
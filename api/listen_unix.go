@@ -0,0 +1,17 @@
+//go:build !windows
+
+package api
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// listenUnix creates a Unix socket at path with permissions 0600. The umask is set while the socket is
+// created, so there is no moment in which other users could connect to it.
+func listenUnix(path string) (net.Listener, error) {
+	old := unix.Umask(0177)
+	defer unix.Umask(old)
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package api
+
+import "net"
+
+// listenUnix creates a Unix socket at path. Windows has no umask; the socket is protected by the ACL of the
+// config directory.
+func listenUnix(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,248 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"claude-squad/log"
+)
+
+// Server serves the control API on a Unix socket. Only the owner of the socket file may connect, which
+// is how callers are authenticated.
+type Server struct {
+	service    *Service
+	httpServer *http.Server
+	path       string
+
+	// tracker derives the events streamed to subscribers from the observations of the host.
+	tracker     *EventTracker
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+	// done is closed when the server shuts down to end event streams.
+	done chan struct{}
+}
+
+// NewServer creates a Server for service.
+func NewServer(service *Service) *Server {
+	s := &Server{
+		service:     service,
+		tracker:     NewEventTracker(),
+		subscribers: make(map[chan Event]struct{}),
+		done:        make(chan struct{}),
+	}
+	s.httpServer = &http.Server{
+		Handler:           s.routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s
+}
+
+// Start listens on the socket at path and serves requests in the background.
+func (s *Server) Start(path string) error {
+	listener, err := Listen(path)
+	if err != nil {
+		return err
+	}
+	s.path = path
+	go func() {
+		if err := s.httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.ErrorLog.Printf("control API server stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Close stops the server and removes its socket.
+func (s *Server) Close() error {
+	close(s.done)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := s.httpServer.Shutdown(ctx)
+	if s.path != "" {
+		if rmErr := os.Remove(s.path); rmErr != nil && !os.IsNotExist(rmErr) {
+			err = errors.Join(err, rmErr)
+		}
+	}
+	return err
+}
+
+// Listen creates a Unix socket at path which only the current user can connect to. A socket left
+// behind by a process that died is replaced, but a socket somebody is still listening on is an error.
+func Listen(path string) (net.Listener, error) {
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("control API is already being served on %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+		}
+	}
+
+	listener, err := listenUnix(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	return listener, nil
+}
+
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/instances", func(w http.ResponseWriter, r *http.Request) {
+		infos, err := s.service.List()
+		respond(w, http.StatusOK, infos, err)
+	})
+	mux.HandleFunc("POST /v1/instances", func(w http.ResponseWriter, r *http.Request) {
+		var req CreateRequest
+		if err := decodeBody(r, &req); err != nil {
+			respond(w, 0, nil, err)
+			return
+		}
+		info, err := s.service.Create(req)
+		respond(w, http.StatusCreated, info, err)
+	})
+	mux.HandleFunc("GET /v1/instances/{ref}", func(w http.ResponseWriter, r *http.Request) {
+		info, err := s.service.Get(r.PathValue("ref"))
+		respond(w, http.StatusOK, info, err)
+	})
+	mux.HandleFunc("DELETE /v1/instances/{ref}", func(w http.ResponseWriter, r *http.Request) {
+		err := s.service.Kill(r.PathValue("ref"))
+		respond(w, http.StatusNoContent, nil, err)
+	})
+	mux.HandleFunc("POST /v1/instances/{ref}/prompt", func(w http.ResponseWriter, r *http.Request) {
+		var req PromptRequest
+		if err := decodeBody(r, &req); err != nil {
+			respond(w, 0, nil, err)
+			return
+		}
+		err := s.service.SendPrompt(r.PathValue("ref"), req)
+		respond(w, http.StatusNoContent, nil, err)
+	})
+	mux.HandleFunc("POST /v1/instances/{ref}/rename", func(w http.ResponseWriter, r *http.Request) {
+		var req RenameRequest
+		if err := decodeBody(r, &req); err != nil {
+			respond(w, 0, nil, err)
+			return
+		}
+		info, err := s.service.Rename(r.PathValue("ref"), req)
+		respond(w, http.StatusOK, info, err)
+	})
+	mux.HandleFunc("POST /v1/instances/{ref}/pause", func(w http.ResponseWriter, r *http.Request) {
+		info, err := s.service.Pause(r.PathValue("ref"))
+		respond(w, http.StatusOK, info, err)
+	})
+	mux.HandleFunc("POST /v1/instances/{ref}/resume", func(w http.ResponseWriter, r *http.Request) {
+		info, err := s.service.Resume(r.PathValue("ref"))
+		respond(w, http.StatusOK, info, err)
+	})
+	mux.HandleFunc("GET /v1/instances/{ref}/diff", func(w http.ResponseWriter, r *http.Request) {
+		diff, err := s.service.Diff(r.PathValue("ref"))
+		respond(w, http.StatusOK, diff, err)
+	})
+	mux.HandleFunc("GET /v1/instances/{ref}/preview", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		preview, err := s.service.Preview(r.PathValue("ref"), query.Has("scrollback"), query.Has("ansi"))
+		respond(w, http.StatusOK, preview, err)
+	})
+	mux.HandleFunc("GET /v1/events", s.handleEvents)
+	return mux
+}
+
+// Observe is called by the host after every poll of its instances. Events derived from the observations
+// are sent to all event streams.
+func (s *Server) Observe(observations []Observation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, event := range s.tracker.Observe(observations) {
+		for ch := range s.subscribers {
+			select {
+			case ch <- event:
+			default:
+				log.WarningLog.Printf("dropped %s event for %s: subscriber is not keeping up", event.Type, event.Title)
+			}
+		}
+	}
+}
+
+// handleEvents streams events as newline delimited JSON until the client disconnects.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	ch := make(chan Event, 256)
+	s.mu.Lock()
+	s.subscribers[ch] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.subscribers, ch)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	encoder := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		case event := <-ch:
+			if err := encoder.Encode(event); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+func decodeBody(r *http.Request, v any) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return errorf(http.StatusBadRequest, "invalid request body: %v", err)
+	}
+	return nil
+}
+
+// respond writes body as JSON with the given status code, or an ErrorResponse if err is non-nil.
+func respond(w http.ResponseWriter, code int, body any, err error) {
+	if err != nil {
+		code = statusCode(err)
+		body = ErrorResponse{Error: err.Error()}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if body == nil || code == http.StatusNoContent {
+		return
+	}
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.ErrorLog.Printf("failed to write control API response: %v", err)
+	}
+}
+
+// Serve starts a control API server on the socket in the config directory. See NewService for program
+// and onChange.
+func Serve(program string, onChange func()) (*Server, error) {
+	path, err := SocketPath()
+	if err != nil {
+		return nil, err
+	}
+	server := NewServer(NewService(program, onChange))
+	if err := server.Start(path); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"claude-squad/session"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), SocketFileName)
+
+	listener, err := Listen(path)
+	require.NoError(t, err)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// A live socket must not be taken over.
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, err = Listen(path)
+	assert.Error(t, err)
+
+	// A stale socket is replaced.
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, listener.Close())
+	listener, err = Listen(path)
+	require.NoError(t, err)
+	listener.Close()
+}
+
+func TestServerErrors(t *testing.T) {
+	server := NewServer(NewService("claude", nil))
+	path := filepath.Join(t.TempDir(), SocketFileName)
+	require.NoError(t, server.Start(path))
+	defer server.Close()
+
+	client := NewHTTPClient(path)
+
+	resp, err := client.Post("http://cs/v1/instances", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = client.Get("http://cs/v1/instances/nope/nothing")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestCreateErrorStatus(t *testing.T) {
+	assert.Equal(t, http.StatusConflict,
+		statusCode(createError(fmt.Errorf("%w: a", session.ErrInstanceExists))))
+	assert.Equal(t, http.StatusConflict,
+		statusCode(createError(fmt.Errorf("%w: too many", session.ErrInstanceLimit))))
+	assert.Equal(t, http.StatusBadRequest,
+		statusCode(createError(fmt.Errorf("%w: too long", session.ErrInvalidTitle))))
+	assert.Equal(t, http.StatusInternalServerError, statusCode(createError(errors.New("tmux failed"))))
+}
@@ -0,0 +1,396 @@
+package api
+
+import (
+	"claude-squad/config"
+	"claude-squad/log"
+	"claude-squad/session"
+	"claude-squad/session/git"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// promptReadyTimeout is how long prompt deliveries wait for an agent to become ready.
+const promptReadyTimeout = 2 * time.Minute
+
+// statusError is an error which carries the HTTP status code to respond with.
+type statusError struct {
+	code int
+	err  error
+}
+
+func (e *statusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *statusError) Unwrap() error {
+	return e.err
+}
+
+func errorf(code int, format string, args ...any) error {
+	return &statusError{code: code, err: fmt.Errorf(format, args...)}
+}
+
+// statusCode returns the HTTP status code for err.
+func statusCode(err error) int {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code
+	}
+	return http.StatusInternalServerError
+}
+
+// Service implements the control API operations on top of instance storage. Storage is reloaded for
+// every operation, so changes made by other processes are picked up.
+type Service struct {
+	// program is the default program for new instances. Empty means the default program of the config of
+	// the repository an instance is created in.
+	program string
+	// onChange is called after an operation added, removed, paused or resumed an instance. May be nil.
+	onChange func()
+	// mu serializes operations which modify storage.
+	mu sync.Mutex
+}
+
+// NewService creates a Service which starts program in new instances unless told otherwise. An empty program
+// starts the default program of the repository. Processes which hold instances in memory pass onChange to
+// reload them when the API modifies storage.
+func NewService(program string, onChange func()) *Service {
+	return &Service{program: program, onChange: onChange}
+}
+
+func (s *Service) changed() {
+	if s.onChange != nil {
+		s.onChange()
+	}
+}
+
+func (s *Service) loadStorage() (*session.Storage, error) {
+	return session.LoadStorage(config.LoadConfig())
+}
+
+// find loads the storage and the stored data of the instance with the given ID or title.
+func (s *Service) find(ref string) (*session.Storage, session.InstanceData, error) {
+	storage, err := s.loadStorage()
+	if err != nil {
+		return nil, session.InstanceData{}, err
+	}
+	instancesData, err := storage.LoadInstanceData()
+	if err != nil {
+		return nil, session.InstanceData{}, err
+	}
+	for _, data := range instancesData {
+		if data.ID == ref {
+			return storage, data, nil
+		}
+	}
+	for _, data := range instancesData {
+		if data.Title == ref {
+			return storage, data, nil
+		}
+	}
+	return nil, session.InstanceData{}, errorf(http.StatusNotFound, "instance not found: %s", ref)
+}
+
+// List returns all stored instances.
+func (s *Service) List() ([]InstanceInfo, error) {
+	storage, err := s.loadStorage()
+	if err != nil {
+		return nil, err
+	}
+	instancesData, err := storage.LoadInstanceData()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]InstanceInfo, 0, len(instancesData))
+	for _, data := range instancesData {
+		infos = append(infos, NewInstanceInfo(data))
+	}
+	return infos, nil
+}
+
+// Get returns the stored instance with the given ID or title.
+func (s *Service) Get(ref string) (InstanceInfo, error) {
+	_, data, err := s.find(ref)
+	if err != nil {
+		return InstanceInfo{}, err
+	}
+	return NewInstanceInfo(data), nil
+}
+
+// Create starts a new instance and sends it the prompt from the request, if any.
+func (s *Service) Create(req CreateRequest) (InstanceInfo, error) {
+	if req.Title == "" {
+		return InstanceInfo{}, errorf(http.StatusBadRequest, "title cannot be empty")
+	}
+	opts := session.InstanceOptions{
+		Title:   req.Title,
+		Path:    req.Path,
+		Program: req.Program,
+		AutoYes: req.AutoYes,
+		BaseRef: req.Base,
+	}
+	if opts.Path == "" {
+		opts.Path = "."
+	}
+	path, err := filepath.Abs(opts.Path)
+	if err != nil {
+		return InstanceInfo{}, errorf(http.StatusBadRequest, "invalid path %s: %v", opts.Path, err)
+	}
+	if !git.IsGitRepo(path) {
+		return InstanceInfo{}, errorf(http.StatusBadRequest, "%s is not within a git repository", path)
+	}
+	opts.Path = path
+	if opts.Program == "" {
+		opts.Program = s.program
+	}
+	if opts.Program == "" {
+		opts.Program = config.LoadConfigFor(path).DefaultProgram
+	}
+
+	s.mu.Lock()
+	storage, err := s.loadStorage()
+	if err != nil {
+		s.mu.Unlock()
+		return InstanceInfo{}, err
+	}
+	instance, err := storage.CreateInstance(opts)
+	s.mu.Unlock()
+	if err != nil {
+		return InstanceInfo{}, createError(err)
+	}
+	s.changed()
+	defer func() {
+		if err := instance.Disconnect(); err != nil {
+			log.ErrorLog.Printf("failed to disconnect from instance %s: %v", instance.Title, err)
+		}
+	}()
+
+	if req.Prompt != "" {
+		if err := instance.WaitUntilReady(promptReadyTimeout); err != nil {
+			return InstanceInfo{}, fmt.Errorf("instance created, but prompt not sent: %w", err)
+		}
+		if err := storage.SendPrompt(instance, req.Prompt); err != nil {
+			return InstanceInfo{}, fmt.Errorf("instance created, but prompt not sent: %w", err)
+		}
+	}
+	return NewInstanceInfo(instance.ToInstanceData()), nil
+}
+
+// createError returns the error for a failed CreateInstance. Instances which conflict with stored ones are
+// refused with 409 and invalid titles with 400. Other failures, e.g. of git or tmux, are internal errors.
+func createError(err error) error {
+	switch {
+	case errors.Is(err, session.ErrInstanceExists), errors.Is(err, session.ErrInstanceLimit):
+		return &statusError{code: http.StatusConflict, err: fmt.Errorf("failed to create instance: %w", err)}
+	case errors.Is(err, session.ErrInvalidTitle):
+		return &statusError{code: http.StatusBadRequest, err: fmt.Errorf("failed to create instance: %w", err)}
+	default:
+		return fmt.Errorf("failed to create instance: %w", err)
+	}
+}
+
+// SendPrompt sends a prompt to a running instance.
+func (s *Service) SendPrompt(ref string, req PromptRequest) error {
+	if req.Prompt == "" {
+		return errorf(http.StatusBadRequest, "prompt cannot be empty")
+	}
+	storage, data, err := s.find(ref)
+	if err != nil {
+		return err
+	}
+	if data.Status == session.Paused {
+		return errorf(http.StatusConflict, "instance %s is paused", data.Title)
+	}
+
+	instance := storage.RestoreInstance(data)
+	if instance.Lost() {
+		return errorf(http.StatusConflict, "instance %s is lost: %s", data.Title, instance.LostReason)
+	}
+	defer func() {
+		if err := instance.Disconnect(); err != nil {
+			log.ErrorLog.Printf("failed to disconnect from instance %s: %v", data.Title, err)
+		}
+	}()
+
+	if err := storage.SendPrompt(instance, req.Prompt); err != nil {
+		return err
+	}
+	if req.WaitReady {
+		return instance.WaitUntilReady(promptReadyTimeout)
+	}
+	return nil
+}
+
+// Pause commits the changes of an instance and pauses it.
+func (s *Service) Pause(ref string) (InstanceInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	storage, data, err := s.find(ref)
+	if err != nil {
+		return InstanceInfo{}, err
+	}
+	if data.Status == session.Paused {
+		return InstanceInfo{}, errorf(http.StatusConflict, "instance %s is already paused", data.Title)
+	}
+	if data.Status == session.Lost {
+		return InstanceInfo{}, errorf(http.StatusConflict, "instance %s is lost: %s", data.Title, data.LostReason)
+	}
+	instance := session.FromInstanceDataDetached(data)
+	if err := instance.Pause(); err != nil {
+		return InstanceInfo{}, err
+	}
+	if err := storage.UpdateInstance(instance); err != nil {
+		return InstanceInfo{}, err
+	}
+	s.changed()
+	return NewInstanceInfo(instance.ToInstanceData()), nil
+}
+
+// Resume resumes a paused instance.
+func (s *Service) Resume(ref string) (InstanceInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	storage, data, err := s.find(ref)
+	if err != nil {
+		return InstanceInfo{}, err
+	}
+	if data.Status != session.Paused {
+		return InstanceInfo{}, errorf(http.StatusConflict, "instance %s is not paused", data.Title)
+	}
+	instance := session.FromInstanceDataDetached(data)
+	if err := instance.Resume(); err != nil {
+		return InstanceInfo{}, err
+	}
+	defer func() {
+		if err := instance.Disconnect(); err != nil {
+			log.ErrorLog.Printf("failed to disconnect from instance %s: %v", data.Title, err)
+		}
+	}()
+	if err := storage.UpdateInstance(instance); err != nil {
+		return InstanceInfo{}, err
+	}
+	s.changed()
+	return NewInstanceInfo(instance.ToInstanceData()), nil
+}
+
+// Rename changes the title of an instance.
+func (s *Service) Rename(ref string, req RenameRequest) (InstanceInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	storage, data, err := s.find(ref)
+	if err != nil {
+		return InstanceInfo{}, err
+	}
+	if err := storage.RenameInstance(data.ID, req.Title); err != nil {
+		return InstanceInfo{}, errorf(http.StatusBadRequest, "%v", err)
+	}
+	_, data, err = s.find(data.ID)
+	if err != nil {
+		return InstanceInfo{}, err
+	}
+	s.changed()
+	return NewInstanceInfo(data), nil
+}
+
+// Kill kills an instance and removes it from storage.
+func (s *Service) Kill(ref string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	storage, data, err := s.find(ref)
+	if err != nil {
+		return err
+	}
+	if err := storage.KillInstance(session.FromInstanceDataDetached(data)); err != nil {
+		return err
+	}
+	s.changed()
+	return nil
+}
+
+// Diff returns the changes made by an instance since its base commit. Paused instances are diffed from
+// their preserved branch.
+func (s *Service) Diff(ref string) (InstanceDiff, error) {
+	_, data, err := s.find(ref)
+	if err != nil {
+		return InstanceDiff{}, err
+	}
+	return DiffInstanceData(data)
+}
+
+// DiffInstanceData returns the changes recorded for the instance since its base commit.
+func DiffInstanceData(data session.InstanceData) (InstanceDiff, error) {
+	if data.Worktree.BaseCommitSHA == "" {
+		return InstanceDiff{}, errorf(http.StatusConflict, "instance %s has no base commit recorded", data.Title)
+	}
+
+	worktree := data.GitWorktree()
+	diff := worktree.DiffWorktree
+	if data.Status == session.Paused {
+		diff = worktree.DiffBranch
+	}
+
+	numStat, err := diff("--numstat")
+	if err != nil {
+		return InstanceDiff{}, err
+	}
+	files, err := git.ParseNumStat(numStat)
+	if err != nil {
+		return InstanceDiff{}, err
+	}
+	patch, err := diff()
+	if err != nil {
+		return InstanceDiff{}, err
+	}
+
+	out := InstanceDiff{
+		ID:            data.ID,
+		Title:         data.Title,
+		Branch:        data.Branch,
+		BaseCommitSHA: data.Worktree.BaseCommitSHA,
+		Files:         files,
+		Patch:         patch,
+	}
+	if out.Files == nil {
+		out.Files = []git.FileDiffStats{}
+	}
+	for _, f := range files {
+		out.Added += f.Added
+		out.Removed += f.Removed
+	}
+	return out, nil
+}
+
+// Preview captures the pane of a running instance. If scrollback is true, the whole history is
+// captured instead of just the visible screen.
+func (s *Service) Preview(ref string, scrollback bool, ansi bool) (PreviewResponse, error) {
+	_, data, err := s.find(ref)
+	if err != nil {
+		return PreviewResponse{}, err
+	}
+	if data.Status == session.Paused {
+		return PreviewResponse{}, errorf(http.StatusConflict, "instance %s is paused", data.Title)
+	}
+	if data.Status == session.Lost {
+		return PreviewResponse{}, errorf(http.StatusConflict, "instance %s is lost: %s", data.Title, data.LostReason)
+	}
+
+	instance := session.FromInstanceDataDetached(data)
+	var content string
+	if scrollback {
+		content, err = instance.Scrollback("-", "-", ansi)
+	} else {
+		content, err = instance.Scrollback("0", "-", ansi)
+	}
+	if err != nil {
+		return PreviewResponse{}, err
+	}
+	return PreviewResponse{Content: content}, nil
+}
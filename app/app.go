@@ -1,15 +1,19 @@
 package app
 
 import (
+	"claude-squad/api"
 	"claude-squad/config"
 	"claude-squad/keys"
 	"claude-squad/log"
 	"claude-squad/session"
+	"claude-squad/session/git"
 	"claude-squad/ui"
 	"claude-squad/ui/overlay"
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/charmbracelet/bubbles/spinner"
@@ -17,16 +21,29 @@ import (
 	"github.com/charmbracelet/lipgloss"
 )
 
-const GlobalInstanceLimit = 10
-
 // Run is the main entrypoint into the application.
-func Run(ctx context.Context, program string, autoYes bool) error {
+func Run(ctx context.Context, program string, autoYes bool, allRepos bool) error {
+	h := newHome(ctx, program, autoYes, allRepos)
 	p := tea.NewProgram(
-		newHome(ctx, program, autoYes),
+		h,
 		tea.WithAltScreen(),
 		tea.WithMouseCellMotion(), // Mouse scroll
 	)
-	_, err := p.Run()
+
+	// Serve the control API while the UI is running. Changes made through it are synced into the list.
+	server, err := api.Serve(program, func() { p.Send(instancesChangedMsg{}) })
+	if err != nil {
+		log.WarningLog.Printf("control API is not available: %v", err)
+	} else {
+		h.apiServer = server
+		defer func() {
+			if err := server.Close(); err != nil {
+				log.ErrorLog.Printf("failed to close control API server: %v", err)
+			}
+		}()
+	}
+
+	_, err = p.Run()
 	return err
 }
 
@@ -40,6 +57,10 @@ const (
 	statePrompt
 	// stateHelp is the state when a help screen is displayed.
 	stateHelp
+	// stateRename is the state when the user is entering a new title for an instance.
+	stateRename
+	// stateRepair is the state when the user is picking how to repair a lost instance.
+	stateRepair
 )
 
 type home struct {
@@ -48,6 +69,11 @@ type home struct {
 	program string
 	autoYes bool
 
+	// repoRoot is the root of the repository the app was started in. Only its instances are listed unless
+	// allRepos is set.
+	repoRoot string
+	allRepos bool
+
 	// ui components
 	list         *ui.List
 	menu         *ui.Menu
@@ -80,17 +106,24 @@ type home struct {
 
 	// keySent is used to manage underlining menu items
 	keySent bool
+
+	// apiServer serves the control API while the UI is running. Nil if it couldn't be started.
+	apiServer *api.Server
 }
 
-func newHome(ctx context.Context, program string, autoYes bool) *home {
+func newHome(ctx context.Context, program string, autoYes bool, allRepos bool) *home {
 	// Load application config
 	appConfig := config.LoadConfig()
 
 	// Load application state
-	appState := config.LoadState()
+	appState, err := config.LoadState()
+	if err != nil {
+		fmt.Printf("Failed to load state: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Initialize storage
-	storage, err := session.NewStorage(appState)
+	storage, err := session.OpenStorage(appConfig, appState)
 	if err != nil {
 		fmt.Printf("Failed to initialize storage: %v\n", err)
 		os.Exit(1)
@@ -108,18 +141,32 @@ func newHome(ctx context.Context, program string, autoYes bool) *home {
 		autoYes:      autoYes,
 		state:        stateDefault,
 		appState:     appState,
+		allRepos:     allRepos,
 	}
 	h.list = ui.NewList(&h.spinner, autoYes)
 
-	// Load saved instances
-	instances, err := storage.LoadInstances()
+	repoRoot, err := git.FindRepoRoot(".")
+	if err != nil {
+		// We can still list the instances of all repos.
+		log.WarningLog.Printf("could not find the current repository, listing all instances: %v", err)
+	}
+	h.repoRoot = repoRoot
+	h.updateScope()
+
+	// Load saved instances. Instances of other repos aren't restored until they are shown. Instances which
+	// can't be restored are listed as lost, so they can be repaired.
+	instancesData, err := storage.LoadInstanceData()
 	if err != nil {
 		fmt.Printf("Failed to load instances: %v\n", err)
 		os.Exit(1)
 	}
 
 	// Add loaded instances to the list
-	for _, instance := range instances {
+	for _, data := range instancesData {
+		if !h.inScope(data) {
+			continue
+		}
+		instance := storage.RestoreInstance(data)
 		// Call the finalizer immediately.
 		h.list.AddInstance(instance)()
 		if autoYes {
@@ -130,6 +177,21 @@ func newHome(ctx context.Context, program string, autoYes bool) *home {
 	return h
 }
 
+// inScope returns true if the instance should be listed: it belongs to the current repo, or all repos are
+// shown.
+func (m *home) inScope(data session.InstanceData) bool {
+	return m.allRepos || m.repoRoot == "" || filepath.Clean(data.Worktree.RepoPath) == m.repoRoot
+}
+
+// updateScope shows which instances are listed in the title of the list.
+func (m *home) updateScope() {
+	if m.allRepos || m.repoRoot == "" {
+		m.list.SetScope("all repos")
+		return
+	}
+	m.list.SetScope(filepath.Base(m.repoRoot))
+}
+
 // updateHandleWindowSizeEvent sets the sizes of the components.
 // The components will try to render inside their bounds.
 func (m *home) updateHandleWindowSizeEvent(msg tea.WindowSizeMsg) {
@@ -188,38 +250,33 @@ func (m *home) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case keyupMsg:
 		m.menu.ClearKeydown()
 		return m, nil
+	case instancesChangedMsg:
+		if err := m.syncInstances(); err != nil {
+			return m, m.handleError(err)
+		}
+		return m, m.instanceChanged()
 	case tickUpdateMetadataMessage:
-		for _, instance := range m.list.GetInstances() {
-			if !instance.Started() || instance.Paused() {
-				continue
-			}
-			updated, prompt := instance.HasUpdated()
-			if updated {
-				instance.SetStatus(session.Running)
-			} else {
-				if prompt {
-					instance.TapEnter()
-				} else {
-					instance.SetStatus(session.Ready)
-				}
-			}
-			if err := instance.UpdateDiffStats(); err != nil {
-				log.WarningLog.Printf("could not update diff stats: %v", err)
-			}
+		// Pick up changes made by `cs` commands while the UI is running.
+		if err := m.syncInstances(); err != nil {
+			log.WarningLog.Printf("could not sync instances: %v", err)
+		}
+		observations := m.updateInstances()
+		if m.apiServer != nil {
+			m.apiServer.Observe(observations)
 		}
 		return m, tickUpdateMetadataCmd
 	case tea.MouseMsg:
-		// Handle mouse wheel scrolling in the diff view
-		if m.tabbedWindow.IsInDiffTab() {
-			if msg.Action == tea.MouseActionPress {
-				switch msg.Button {
-				case tea.MouseButtonWheelUp:
-					m.tabbedWindow.ScrollUp()
-					return m, m.instanceChanged()
-				case tea.MouseButtonWheelDown:
-					m.tabbedWindow.ScrollDown()
-					return m, m.instanceChanged()
+		// Handle mouse wheel scrolling in the diff view and the preview
+		if msg.Action == tea.MouseActionPress {
+			switch msg.Button {
+			case tea.MouseButtonWheelUp:
+				if err := m.tabbedWindow.ScrollUp(); err != nil {
+					return m, m.handleError(err)
 				}
+				return m, m.instanceChanged()
+			case tea.MouseButtonWheelDown:
+				m.tabbedWindow.ScrollDown()
+				return m, m.instanceChanged()
 			}
 		}
 		return m, nil
@@ -250,7 +307,7 @@ func (m *home) handleMenuHighlighting(msg tea.KeyMsg) (cmd tea.Cmd, returnEarly
 		m.keySent = false
 		return nil, false
 	}
-	if m.state == statePrompt || m.state == stateHelp {
+	if m.state == statePrompt || m.state == stateHelp || m.state == stateRename || m.state == stateRepair {
 		return nil, false
 	}
 	// If it's in the global keymap, we should try to highlight it.
@@ -262,7 +319,9 @@ func (m *home) handleMenuHighlighting(msg tea.KeyMsg) (cmd tea.Cmd, returnEarly
 	if m.list.GetSelectedInstance() != nil && m.list.GetSelectedInstance().Paused() && name == keys.KeyEnter {
 		return nil, false
 	}
-	if name == keys.KeyShiftDown || name == keys.KeyShiftUp {
+	switch name {
+	case keys.KeyShiftDown, keys.KeyShiftUp, keys.KeyPageUp, keys.KeyPageDown, keys.KeyTop, keys.KeyBottom,
+		keys.KeyFollow, keys.KeyStopScroll:
 		return nil, false
 	}
 
@@ -271,6 +330,9 @@ func (m *home) handleMenuHighlighting(msg tea.KeyMsg) (cmd tea.Cmd, returnEarly
 	if name == keys.KeyEnter && m.state == stateNew {
 		name = keys.KeySubmitName
 	}
+	if name == keys.KeyEnter && m.list.GetSelectedInstance() != nil && m.list.GetSelectedInstance().Lost() {
+		name = keys.KeyRepair
+	}
 	m.keySent = true
 	return tea.Batch(
 		func() tea.Msg { return msg },
@@ -286,6 +348,9 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 	if m.state == stateHelp {
 		return m.handleHelpState(msg)
 	}
+	if m.state == stateRepair {
+		return m.handleRepairState(msg)
+	}
 
 	if m.state == stateNew {
 		// Handle quit commands first. Don't handle q because the user might want to type that.
@@ -306,8 +371,8 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 		switch msg.Type {
 		// Start the instance (enable previews etc) and go back to the main menu state.
 		case tea.KeyEnter:
-			if len(instance.Title) == 0 {
-				return m, m.handleError(fmt.Errorf("title cannot be empty"))
+			if err := m.storage.CheckNewInstance(instance.Title, instance.Path); err != nil {
+				return m, m.handleError(err)
 			}
 
 			if err := instance.Start(true); err != nil {
@@ -316,7 +381,9 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 				return m, m.handleError(err)
 			}
 			// Save after adding new instance
-			if err := m.storage.SaveInstances(m.list.GetInstances()); err != nil {
+			if err := m.storage.AddInstance(instance); err != nil {
+				m.list.Kill()
+				m.state = stateDefault
 				return m, m.handleError(err)
 			}
 			// Instance added successfully, call the finalizer.
@@ -384,7 +451,7 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 				if selected == nil {
 					return m, nil
 				}
-				if err := selected.SendPrompt(m.textInputOverlay.GetValue()); err != nil {
+				if err := m.storage.SendPrompt(selected, m.textInputOverlay.GetValue()); err != nil {
 					return m, m.handleError(err)
 				}
 			}
@@ -403,6 +470,32 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 		}
 
 		return m, nil
+	} else if m.state == stateRename {
+		shouldClose := m.textInputOverlay.HandleKeyPress(msg)
+		if !shouldClose {
+			return m, nil
+		}
+
+		var err error
+		if m.textInputOverlay.IsSubmitted() {
+			if selected := m.list.GetSelectedInstance(); selected != nil {
+				title := strings.TrimSpace(m.textInputOverlay.GetValue())
+				if err = m.storage.RenameInstance(selected.ID, title); err == nil {
+					err = selected.SetTitle(title)
+				}
+			}
+		}
+
+		m.textInputOverlay = nil
+		m.state = stateDefault
+		cmds := []tea.Cmd{tea.WindowSize(), func() tea.Msg {
+			m.menu.SetState(ui.StateDefault)
+			return nil
+		}}
+		if err != nil {
+			cmds = append(cmds, m.handleError(err))
+		}
+		return m, tea.Sequence(cmds...)
 	}
 
 	// Handle quit commands first
@@ -419,9 +512,9 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 	case keys.KeyHelp:
 		return m.showHelpScreen(helpTypeGeneral, nil)
 	case keys.KeyPrompt:
-		if m.list.NumInstances() >= GlobalInstanceLimit {
+		if m.list.NumInstances() >= session.GlobalInstanceLimit {
 			return m, m.handleError(
-				fmt.Errorf("you can't create more than %d instances", GlobalInstanceLimit))
+				fmt.Errorf("you can't create more than %d instances", session.GlobalInstanceLimit))
 		}
 		instance, err := session.NewInstance(session.InstanceOptions{
 			Title:   "",
@@ -440,9 +533,9 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 
 		return m, nil
 	case keys.KeyNew:
-		if m.list.NumInstances() >= GlobalInstanceLimit {
+		if m.list.NumInstances() >= session.GlobalInstanceLimit {
 			return m, m.handleError(
-				fmt.Errorf("you can't create more than %d instances", GlobalInstanceLimit))
+				fmt.Errorf("you can't create more than %d instances", session.GlobalInstanceLimit))
 		}
 		instance, err := session.NewInstance(session.InstanceOptions{
 			Title:   "",
@@ -459,6 +552,22 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 		m.menu.SetState(ui.StateNewInstance)
 
 		return m, nil
+	case keys.KeyToggleRepos:
+		m.allRepos = !m.allRepos
+		m.updateScope()
+		if err := m.syncInstances(); err != nil {
+			return m, m.handleError(err)
+		}
+		return m, m.instanceChanged()
+	case keys.KeyRename:
+		selected := m.list.GetSelectedInstance()
+		if selected == nil {
+			return m, nil
+		}
+		m.state = stateRename
+		m.menu.SetState(ui.StatePrompt)
+		m.textInputOverlay = overlay.NewTextInputOverlay("Rename session", selected.Title)
+		return m, tea.WindowSize()
 	case keys.KeyUp:
 		m.list.Up()
 		return m, m.instanceChanged()
@@ -466,15 +575,44 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 		m.list.Down()
 		return m, m.instanceChanged()
 	case keys.KeyShiftUp:
-		if m.tabbedWindow.IsInDiffTab() {
-			m.tabbedWindow.ScrollUp()
+		if err := m.tabbedWindow.ScrollUp(); err != nil {
+			return m, m.handleError(err)
 		}
 		return m, m.instanceChanged()
 	case keys.KeyShiftDown:
-		if m.tabbedWindow.IsInDiffTab() {
-			m.tabbedWindow.ScrollDown()
+		m.tabbedWindow.ScrollDown()
+		return m, m.instanceChanged()
+	case keys.KeyPageUp:
+		if err := m.tabbedWindow.PageUp(); err != nil {
+			return m, m.handleError(err)
 		}
 		return m, m.instanceChanged()
+	case keys.KeyPageDown:
+		m.tabbedWindow.PageDown()
+		return m, m.instanceChanged()
+	case keys.KeyTop:
+		if err := m.tabbedWindow.GotoTop(); err != nil {
+			return m, m.handleError(err)
+		}
+		return m, m.instanceChanged()
+	case keys.KeyBottom:
+		m.tabbedWindow.GotoBottom()
+		return m, m.instanceChanged()
+	case keys.KeyFollow:
+		if err := m.tabbedWindow.ToggleFollow(); err != nil {
+			return m, m.handleError(err)
+		}
+		return m, m.instanceChanged()
+	case keys.KeyStopScroll:
+		m.tabbedWindow.StopScrolling()
+		return m, m.instanceChanged()
+	case keys.KeyWindow:
+		selected := m.list.GetSelectedInstance()
+		if selected == nil || m.tabbedWindow.IsInDiffTab() {
+			return m, nil
+		}
+		selected.CycleWindow()
+		return m, m.instanceChanged()
 	case keys.KeyTab:
 		m.tabbedWindow.Toggle()
 		m.menu.SetInDiffTab(m.tabbedWindow.IsInDiffTab())
@@ -485,33 +623,21 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 			return m, nil
 		}
 
-		worktree, err := selected.GetGitWorktree()
-		if err != nil {
-			return m, m.handleError(err)
-		}
-
-		checkedOut, err := worktree.IsBranchCheckedOut()
-		if err != nil {
-			return m, m.handleError(err)
-		}
-
-		if checkedOut {
-			return m, m.handleError(fmt.Errorf("instance %s is currently checked out", selected.Title))
-		}
-
-		// Delete from storage first
-		if err := m.storage.DeleteInstance(selected.Title); err != nil {
+		// Archive the instance, then delete it from storage and kill it. Instances whose branch is checked
+		// out are refused.
+		if err := m.storage.KillInstance(selected); err != nil {
 			return m, m.handleError(err)
 		}
-
-		// Then kill the instance
-		m.list.Kill()
+		m.list.Remove(selected)
 		return m, m.instanceChanged()
 	case keys.KeySubmit:
 		selected := m.list.GetSelectedInstance()
 		if selected == nil {
 			return m, nil
 		}
+		if selected.Lost() {
+			return m, m.handleError(fmt.Errorf("cannot push lost instance %s, repair or kill it instead", selected.Title))
+		}
 
 		// Default commit message with timestamp
 		commitMsg := fmt.Sprintf("[claudesquad] update from '%s' on %s", selected.Title, time.Now().Format(time.RFC822))
@@ -534,6 +660,8 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 		m.showHelpScreen(helpTypeInstanceCheckout, func() {
 			if err := selected.Pause(); err != nil {
 				m.handleError(err)
+			} else if err := m.storage.UpdateInstance(selected); err != nil {
+				m.handleError(err)
 			}
 			m.instanceChanged()
 		})
@@ -546,12 +674,18 @@ func (m *home) handleKeyPress(msg tea.KeyMsg) (mod tea.Model, cmd tea.Cmd) {
 		if err := selected.Resume(); err != nil {
 			return m, m.handleError(err)
 		}
+		if err := m.storage.UpdateInstance(selected); err != nil {
+			return m, m.handleError(err)
+		}
 		return m, tea.WindowSize()
 	case keys.KeyEnter:
 		if m.list.NumInstances() == 0 {
 			return m, nil
 		}
 		selected := m.list.GetSelectedInstance()
+		if selected != nil && selected.Lost() {
+			return m.showRepairScreen(selected)
+		}
 		if selected == nil || selected.Paused() || !selected.TmuxAlive() {
 			return m, nil
 		}
@@ -611,8 +745,110 @@ type previewTickMsg struct{}
 
 type tickUpdateMetadataMessage struct{}
 
-// tickUpdateMetadataCmd is the callback to update the metadata of the instances every 500ms. Note that we iterate
-// overall the instances and capture their output. It's a pretty expensive operation. Let's do it 2x a second only.
+// instancesChangedMsg implements tea.Msg and is sent when the control API modified storage, so the list
+// is synced without waiting for the next metadata tick.
+type instancesChangedMsg struct{}
+
+// syncInstances reconciles the list with storage after another process added, removed, renamed, paused,
+// resumed or repaired instances, and after the repos shown were toggled. Instances whose state changed
+// underneath us are restored again. It runs on every metadata tick and right after the control API changed
+// something.
+func (m *home) syncInstances() error {
+	instancesData, err := m.storage.LoadInstanceData()
+	if err != nil {
+		return err
+	}
+	stored := make(map[string]session.InstanceData, len(instancesData))
+	for _, data := range instancesData {
+		stored[data.ID] = data
+	}
+
+	for _, instance := range append([]*session.Instance(nil), m.list.GetInstances()...) {
+		// Skip the instance currently being created.
+		if !instance.Started() {
+			continue
+		}
+		data, ok := stored[instance.ID]
+		if ok && !m.inScope(data) {
+			ok = false
+			delete(stored, instance.ID)
+		}
+		if ok && (data.Status == session.Paused) == instance.Paused() &&
+			(data.Status == session.Lost) == instance.Lost() {
+			// Pick up renames.
+			instance.Title = data.Title
+			delete(stored, instance.ID)
+			continue
+		}
+		if err := instance.Disconnect(); err != nil {
+			log.ErrorLog.Printf("failed to disconnect from instance %s: %v", instance.Title, err)
+		}
+		m.list.Remove(instance)
+	}
+
+	if len(stored) == 0 {
+		return nil
+	}
+	for _, data := range instancesData {
+		if _, ok := stored[data.ID]; !ok || !m.inScope(data) {
+			continue
+		}
+		// Instances which turn out to be lost are stored as such, so they aren't restored on every tick.
+		instance := m.storage.RestoreInstance(data)
+		if m.autoYes {
+			instance.AutoYes = true
+		}
+		m.list.AddInstance(instance)()
+	}
+
+	previewWidth, previewHeight := m.tabbedWindow.GetPreviewSize()
+	return m.list.SetSessionPreviewSize(previewWidth, previewHeight)
+}
+
+// updateInstances updates the status and diff stats of the listed instances and returns the observations of all
+// stored instances for the control API. Instances of other repos than the ones listed are observed as stored, so
+// events are reported for every instance, and toggling the repos shown doesn't look like instances coming and
+// going.
+func (m *home) updateInstances() []api.Observation {
+	observations := make([]api.Observation, 0, m.list.NumInstances())
+	listed := make(map[string]bool, m.list.NumInstances())
+	for _, instance := range m.list.GetInstances() {
+		listed[instance.ID] = true
+		if !instance.Started() || instance.Paused() || instance.Lost() {
+			observations = append(observations, api.Observation{Instance: instance})
+			continue
+		}
+		updated, prompt := instance.HasUpdated()
+		observations = append(observations, api.Observation{Instance: instance, Prompt: prompt})
+		if updated {
+			instance.SetStatus(session.Running)
+		} else {
+			if prompt {
+				instance.TapEnter()
+			} else {
+				instance.SetStatus(session.Ready)
+			}
+		}
+		if err := instance.UpdateDiffStats(); err != nil {
+			log.WarningLog.Printf("could not update diff stats: %v", err)
+		}
+	}
+
+	instancesData, err := m.storage.LoadInstanceData()
+	if err != nil {
+		log.WarningLog.Printf("could not load the instances of other repos: %v", err)
+		return observations
+	}
+	for _, data := range instancesData {
+		if !listed[data.ID] {
+			observations = append(observations, api.Observation{Data: &data})
+		}
+	}
+	return observations
+}
+
+// tickUpdateMetadataCmd is the callback to update the metadata of the instances every 500ms. Panes are only
+// captured if they printed something since the last tick, but the diff stats are computed every time.
 var tickUpdateMetadataCmd = func() tea.Msg {
 	time.Sleep(500 * time.Millisecond)
 	return tickUpdateMetadataMessage{}
@@ -645,12 +881,12 @@ func (m *home) View() string {
 		m.errBox.String(),
 	)
 
-	if m.state == statePrompt {
+	if m.state == statePrompt || m.state == stateRename {
 		if m.textInputOverlay == nil {
 			log.ErrorLog.Printf("text input overlay is nil")
 		}
 		return overlay.PlaceOverlay(0, 0, m.textInputOverlay.Render(), mainView, true, true)
-	} else if m.state == stateHelp {
+	} else if m.state == stateHelp || m.state == stateRepair {
 		if m.textOverlay == nil {
 			log.ErrorLog.Printf("text overlay is nil")
 		}
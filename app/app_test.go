@@ -0,0 +1,65 @@
+package app
+
+import (
+	"claude-squad/api"
+	"claude-squad/config"
+	"claude-squad/log"
+	"claude-squad/session"
+	"claude-squad/ui"
+	"path/filepath"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToggleReposKeepsEvents(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	log.Initialize(false)
+	defer log.Close()
+
+	state, err := config.LoadState()
+	require.NoError(t, err)
+	storage, err := session.NewStorage(state)
+	require.NoError(t, err)
+	repoA, repoB := filepath.Join(t.TempDir(), "a"), filepath.Join(t.TempDir(), "b")
+	// Paused instances are restored without tmux.
+	for _, data := range []session.InstanceData{
+		{ID: "1", Title: "a", Status: session.Paused, Worktree: session.GitWorktreeData{RepoPath: repoA}},
+		{ID: "2", Title: "b", Status: session.Paused, Worktree: session.GitWorktreeData{RepoPath: repoB}},
+	} {
+		require.NoError(t, storage.AddInstance(session.FromInstanceDataDetached(data)))
+	}
+
+	m := &home{
+		spinner:      spinner.New(),
+		menu:         ui.NewMenu(),
+		tabbedWindow: ui.NewTabbedWindow(ui.NewPreviewPane(), ui.NewDiffPane()),
+		storage:      storage,
+		repoRoot:     repoA,
+	}
+	m.list = ui.NewList(&m.spinner, false)
+	m.updateScope()
+	require.NoError(t, m.syncInstances())
+	require.Equal(t, 1, m.list.NumInstances())
+
+	tracker := api.NewEventTracker()
+	// The first observation is the baseline, which includes the instance of the other repo.
+	assert.Empty(t, tracker.Observe(m.updateInstances()))
+
+	for range 2 {
+		m.allRepos = !m.allRepos
+		m.updateScope()
+		require.NoError(t, m.syncInstances())
+		assert.Empty(t, tracker.Observe(m.updateInstances()))
+	}
+	assert.Equal(t, 1, m.list.NumInstances())
+
+	// Instances of other repos which are killed are still reported.
+	require.NoError(t, storage.DeleteInstance("2"))
+	events := tracker.Observe(m.updateInstances())
+	require.Len(t, events, 1)
+	assert.Equal(t, api.EventKilled, events[0].Type)
+	assert.Equal(t, "2", events[0].ID)
+}
@@ -48,6 +48,7 @@ func (h helpType) ToContent(instance *session.Instance) string {
 			keyStyle.Render("n")+descStyle.Render("         - Create a new session"),
 			keyStyle.Render("N")+descStyle.Render("         - Create a new session with a prompt"),
 			keyStyle.Render("D")+descStyle.Render("         - Kill (delete) the selected session"),
+			keyStyle.Render("R")+descStyle.Render("         - Rename the selected session"),
 			keyStyle.Render("↑/j, ↓/k")+descStyle.Render("  - Navigate between sessions"),
 			keyStyle.Render("↵/o")+descStyle.Render("       - Attach to the selected session"),
 			keyStyle.Render("ctrl-q")+descStyle.Render("    - Detach from session"),
@@ -56,10 +57,16 @@ func (h helpType) ToContent(instance *session.Instance) string {
 			keyStyle.Render("p")+descStyle.Render("         - Commit and push branch to github"),
 			keyStyle.Render("c")+descStyle.Render("         - Checkout: commit changes and pause session"),
 			keyStyle.Render("r")+descStyle.Render("         - Resume a paused session"),
+			keyStyle.Render("↵/o")+descStyle.Render("       - Repair a lost session"),
 			"",
 			headerStyle.Render("Other:"),
 			keyStyle.Render("tab")+descStyle.Render("       - Switch between preview and diff tabs"),
-			keyStyle.Render("shift-↓/↑")+descStyle.Render(" - Scroll in diff view"),
+			keyStyle.Render("w")+descStyle.Render("         - Switch the preview between the agent and its companions"),
+			keyStyle.Render("shift-↓/↑")+descStyle.Render(" - Scroll the preview through the session's history, or the diff"),
+			keyStyle.Render("pgup/pgdn")+descStyle.Render(" - Scroll a page, home/end jump to the top/bottom"),
+			keyStyle.Render("f")+descStyle.Render("         - Follow new output while scrolling the preview"),
+			keyStyle.Render("esc")+descStyle.Render("       - Stop scrolling the preview"),
+			keyStyle.Render("a")+descStyle.Render("         - Toggle between this repo's sessions and all repos"),
 			keyStyle.Render("q")+descStyle.Render("         - Quit the application"),
 		)
 		return content
@@ -0,0 +1,67 @@
+package app
+
+import (
+	"claude-squad/session"
+	"claude-squad/ui"
+	"claude-squad/ui/overlay"
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// showRepairScreen displays the repair options for a lost instance.
+func (m *home) showRepairScreen(instance *session.Instance) (tea.Model, tea.Cmd) {
+	content := lipgloss.JoinVertical(lipgloss.Left,
+		titleStyle.Render("Repair Instance"),
+		"",
+		descStyle.Render(fmt.Sprintf("%s is lost: %s.", instance.Title, instance.LostReason)),
+		"",
+		headerStyle.Render("Options:"),
+		keyStyle.Render("r")+descStyle.Render("   - Restart the agent in the existing worktree"),
+		keyStyle.Render("w")+descStyle.Render(fmt.Sprintf("   - Recreate the worktree from branch %s and restart the agent",
+			instance.Branch)),
+		keyStyle.Render("d")+descStyle.Render("   - Discard the record, keeping the branch and any worktree"),
+		keyStyle.Render("esc")+descStyle.Render(" - Cancel"),
+	)
+	m.textOverlay = overlay.NewTextOverlay(content)
+	m.state = stateRepair
+	return m, nil
+}
+
+// handleRepairState handles key events when in repair state. Any key other than the repair options closes
+// the overlay.
+func (m *home) handleRepairState(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.textOverlay = nil
+	m.state = stateDefault
+	cmds := []tea.Cmd{tea.WindowSize(), func() tea.Msg {
+		m.menu.SetState(ui.StateDefault)
+		return nil
+	}}
+
+	selected := m.list.GetSelectedInstance()
+	if selected == nil || !selected.Lost() {
+		return m, tea.Sequence(cmds...)
+	}
+
+	var err error
+	switch msg.String() {
+	case "r":
+		if err = selected.RestartAgent(); err == nil {
+			err = m.storage.UpdateInstance(selected)
+		}
+	case "w":
+		if err = selected.RecreateWorktree(); err == nil {
+			err = m.storage.UpdateInstance(selected)
+		}
+	case "d":
+		if err = m.storage.DeleteInstance(selected.ID); err == nil {
+			m.list.Remove(selected)
+		}
+	}
+	if err != nil {
+		cmds = append(cmds, m.handleError(err))
+	}
+	cmds = append(cmds, m.instanceChanged())
+	return m, tea.Sequence(cmds...)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"claude-squad/log"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var attachWindowFlag string
+
+var attachCmd = &cobra.Command{
+	Use:   "attach <title|index>",
+	Short: "Attach to an instance's session (press ctrl-q to detach)",
+	Long: "Attach to an instance's session (press ctrl-q to detach). --window attaches to one of the companion\n" +
+		"windows configured with `companions` instead of the agent, starting it if it isn't running.",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log.Initialize(false)
+		defer log.CloseSilently()
+
+		stdinFd := int(os.Stdin.Fd())
+		if !term.IsTerminal(stdinFd) {
+			return fmt.Errorf("attach requires an interactive terminal")
+		}
+
+		storage, err := loadStorage()
+		if err != nil {
+			return err
+		}
+		instance, err := loadInstance(storage, args[0])
+		if err != nil {
+			return err
+		}
+		if attachWindowFlag != "" {
+			if err := instance.SelectWindow(attachWindowFlag); err != nil {
+				return err
+			}
+		}
+
+		if instance.Paused() {
+			fmt.Printf("Instance %s is paused. Resume it? [y/N] ", instance.Title)
+			answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil {
+				return fmt.Errorf("failed to read answer: %w", err)
+			}
+			if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+				return nil
+			}
+			if err := instance.Resume(); err != nil {
+				return err
+			}
+			if err := storage.UpdateInstance(instance); err != nil {
+				return err
+			}
+		}
+		if !instance.TmuxAlive() {
+			return fmt.Errorf("tmux session for instance %s is not running", instance.Title)
+		}
+
+		oldState, err := term.MakeRaw(stdinFd)
+		if err != nil {
+			return fmt.Errorf("failed to put terminal into raw mode: %w", err)
+		}
+		defer func() {
+			_ = term.Restore(stdinFd, oldState)
+		}()
+
+		// Use the alternate screen so the shell is left as it was after detaching.
+		fmt.Print("\x1b[?1049h")
+		defer fmt.Print("\x1b[?1049l")
+
+		ch, err := instance.Attach()
+		if err != nil {
+			return err
+		}
+		<-ch
+		return nil
+	},
+}
+
+func init() {
+	attachCmd.Flags().StringVarP(&attachWindowFlag, "window", "w", "",
+		"Window to attach to: agent or the name of a companion")
+	rootCmd.AddCommand(attachCmd)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"claude-squad/config"
+	"claude-squad/daemon"
+	"claude-squad/log"
+	"claude-squad/session"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// batchTask is an entry of a batch task file. YAML is a superset of JSON, so the same struct is used for
+// both formats.
+type batchTask struct {
+	Title   string `yaml:"title"`
+	Program string `yaml:"program"`
+	Base    string `yaml:"base"`
+	Path    string `yaml:"path"`
+	Prompt  string `yaml:"prompt"`
+	AutoYes bool   `yaml:"autoyes"`
+}
+
+// batchResult records the outcome of a single task.
+type batchResult struct {
+	task     batchTask
+	instance *session.Instance
+	err      error
+}
+
+var batchCmd = &cobra.Command{
+	Use:   "batch <tasks.yaml|tasks.json>",
+	Short: "Create an instance for every task in a file",
+	Long: `Create an instance for every task in a YAML or JSON file and send each one its prompt once the
+agent is ready. A failing task doesn't stop the others. Each task accepts:
+
+  - title: fix-login          # required
+    program: claude           # defaults to the configured default program
+    base: main                # branch, tag or commit to start from, defaults to HEAD
+    path: .                   # path within the git repository, defaults to the current directory
+    prompt: Fix the redirect  # sent once the agent is ready
+    autoyes: false            # automatically accept prompts`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log.Initialize(false)
+		defer log.CloseSilently()
+
+		content, err := os.ReadFile(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to read task file: %w", err)
+		}
+		var tasks []batchTask
+		if err := yaml.Unmarshal(content, &tasks); err != nil {
+			return fmt.Errorf("failed to parse task file: %w", err)
+		}
+		if len(tasks) == 0 {
+			return fmt.Errorf("task file %s has no tasks", args[0])
+		}
+
+		storage, err := loadStorage()
+		if err != nil {
+			return err
+		}
+
+		// Create the instances one by one since they share the repository, then deliver the prompts
+		// concurrently as each agent becomes ready.
+		results := make([]*batchResult, len(tasks))
+		autoYes := false
+		for i, task := range tasks {
+			results[i] = &batchResult{task: task}
+			opts := session.InstanceOptions{
+				Title:   task.Title,
+				Path:    task.Path,
+				Program: task.Program,
+				BaseRef: task.Base,
+			}
+			if opts.Path == "" {
+				opts.Path = "."
+			}
+			if opts.Path, err = filepath.Abs(opts.Path); err != nil {
+				results[i].err = fmt.Errorf("failed to get absolute path: %w", err)
+				continue
+			}
+			cfg := config.LoadConfigFor(opts.Path)
+			opts.AutoYes = task.AutoYes || cfg.AutoYes
+			if opts.Program == "" {
+				opts.Program = cfg.DefaultProgram
+			}
+
+			fmt.Printf("Creating %s...\n", task.Title)
+			results[i].instance, results[i].err = storage.CreateInstance(opts)
+			if results[i].err == nil && opts.AutoYes {
+				autoYes = true
+			}
+		}
+
+		if autoYes {
+			if err := daemon.RestartDaemon(); err != nil {
+				log.ErrorLog.Printf("failed to restart daemon: %v", err)
+			}
+		}
+
+		wg := &sync.WaitGroup{}
+		for _, result := range results {
+			if result.err != nil || result.task.Prompt == "" {
+				continue
+			}
+			wg.Add(1)
+			go func(result *batchResult) {
+				defer wg.Done()
+				if err := result.instance.WaitUntilReady(defaultReadyTimeout); err != nil {
+					result.err = fmt.Errorf("created, but prompt not sent: %w", err)
+					return
+				}
+				if err := storage.SendPrompt(result.instance, result.task.Prompt); err != nil {
+					result.err = fmt.Errorf("created, but prompt not sent: %w", err)
+				}
+			}(result)
+		}
+		wg.Wait()
+
+		failed := 0
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TITLE\tRESULT")
+		for _, result := range results {
+			if result.err != nil {
+				failed++
+				fmt.Fprintf(w, "%s\tfailed: %v\n", result.task.Title, result.err)
+				continue
+			}
+			fmt.Fprintf(w, "%s\tcreated on branch %s\n", result.task.Title, result.instance.Branch)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d of %d tasks failed", failed, len(tasks))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(batchCmd)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"claude-squad/config"
+	"claude-squad/session"
+	"fmt"
+	"path"
+	"strconv"
+	"time"
+)
+
+// defaultReadyTimeout is how long commands wait for an agent to become ready before giving up.
+const defaultReadyTimeout = 2 * time.Minute
+
+// loadStorage loads the application state from disk and wraps the configured instance storage.
+func loadStorage() (*session.Storage, error) {
+	return session.LoadStorage(config.LoadConfig())
+}
+
+// findInstanceData resolves an instance by ID or title, falling back to its 1-based index as printed by
+// `cs list`.
+func findInstanceData(instancesData []session.InstanceData, ref string) (session.InstanceData, error) {
+	for _, data := range instancesData {
+		if data.ID == ref {
+			return data, nil
+		}
+	}
+	for _, data := range instancesData {
+		if data.Title == ref {
+			return data, nil
+		}
+	}
+	if idx, err := strconv.Atoi(ref); err == nil && idx >= 1 && idx <= len(instancesData) {
+		return instancesData[idx-1], nil
+	}
+	return session.InstanceData{}, fmt.Errorf("instance not found: %s", ref)
+}
+
+// loadInstance resolves an instance from storage and restores its tmux session.
+func loadInstance(storage *session.Storage, ref string) (*session.Instance, error) {
+	instancesData, err := storage.LoadInstanceData()
+	if err != nil {
+		return nil, err
+	}
+	data, err := findInstanceData(instancesData, ref)
+	if err != nil {
+		return nil, err
+	}
+	instance := storage.RestoreInstance(data)
+	if instance.Lost() {
+		return nil, fmt.Errorf("instance %s is lost: %s. Repair or discard it in the TUI", data.Title,
+			instance.LostReason)
+	}
+	return instance, nil
+}
+
+// selectInstanceData returns the instances picked by the positional title or index arguments, or by
+// the --all and --filter selectors. filter is a glob pattern matched against titles.
+func selectInstanceData(instancesData []session.InstanceData, refs []string, all bool, filter string) (
+	[]session.InstanceData, error) {
+	if len(refs) > 0 && (all || filter != "") {
+		return nil, fmt.Errorf("cannot combine instance arguments with --all or --filter")
+	}
+
+	var selected []session.InstanceData
+	switch {
+	case all:
+		selected = instancesData
+	case filter != "":
+		for _, data := range instancesData {
+			matched, err := path.Match(filter, data.Title)
+			if err != nil {
+				return nil, fmt.Errorf("invalid filter %q: %w", filter, err)
+			}
+			if matched {
+				selected = append(selected, data)
+			}
+		}
+	default:
+		if len(refs) == 0 {
+			return nil, fmt.Errorf("specify instances by title or index, or use --all or --filter")
+		}
+		for _, ref := range refs {
+			data, err := findInstanceData(instancesData, ref)
+			if err != nil {
+				return nil, err
+			}
+			selected = append(selected, data)
+		}
+	}
+
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no instances matched")
+	}
+	return selected, nil
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"claude-squad/config"
+	"claude-squad/log"
+	"claude-squad/session/git"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	configProjectFlag bool
+
+	configCmd = &cobra.Command{
+		Use:   "config",
+		Short: "Read, change and validate the config",
+		Long: "Read, change and validate the config. The global config file is layered with the project " +
+			"config file (" + config.ProjectConfigFileName + ") of the current repository and the CS_* " +
+			"environment variables, each overriding the keys the previous one sets. Project config files can " +
+			"only set default_program, branch_prefix, auto_yes and companions.",
+		// The config commands have to work with an invalid config, so it can be fixed.
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return nil
+		},
+	}
+
+	configGetCmd = &cobra.Command{
+		Use:   "get [key]",
+		Short: "Print the value of a config key, or of all keys",
+		Long:  "Print the value of a config key after layering the config files and environment variables.",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.CloseSilently()
+
+			cfg := config.LoadConfig()
+			if len(args) == 1 {
+				value, err := config.GetConfigValue(cfg, args[0])
+				if err != nil {
+					return err
+				}
+				fmt.Println(value)
+				return nil
+			}
+			for _, key := range config.ConfigKeys() {
+				value, err := config.GetConfigValue(cfg, key)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("%s = %s\n", key, value)
+			}
+			return nil
+		},
+	}
+
+	configSetCmd = &cobra.Command{
+		Use:   "set <key> <value>",
+		Short: "Set a config key in the global or project config file",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.CloseSilently()
+
+			path, err := configFilePath(configProjectFlag)
+			if err != nil {
+				return err
+			}
+			if err := config.SetConfigFileValue(path, args[0], args[1]); err != nil {
+				return err
+			}
+			fmt.Printf("Set %s in %s\n", args[0], path)
+			if _, ok := os.LookupEnv(config.EnvVarName(args[0])); ok {
+				fmt.Printf("Note: %s is set and overrides this value\n", config.EnvVarName(args[0]))
+			}
+			if err := config.ValidateConfigFile(path); err != nil {
+				fmt.Fprintf(os.Stderr, "The file has other problems:\n%v\n", err)
+			}
+			return nil
+		},
+	}
+
+	configEditCmd = &cobra.Command{
+		Use:   "edit",
+		Short: "Edit the global or project config file in $EDITOR",
+		Long: "Open the global or project config file in $VISUAL or $EDITOR. The file is only saved if it is " +
+			"valid; otherwise you can edit it again or discard the changes.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.CloseSilently()
+
+			path, err := configFilePath(configProjectFlag)
+			if err != nil {
+				return err
+			}
+			return editConfigFile(path, configProjectFlag)
+		},
+	}
+
+	configValidateCmd = &cobra.Command{
+		Use:   "validate",
+		Short: "Report unknown keys, values of the wrong type and impossible values",
+		Long: "Validate the global config file, the project config file of the current repository and the " +
+			"CS_* environment variables.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.CloseSilently()
+
+			invalid := false
+			report := func(source string, err error) {
+				if err == nil {
+					fmt.Printf("%s: ok\n", source)
+					return
+				}
+				invalid = true
+				fmt.Println(err)
+			}
+
+			globalPath, err := config.ConfigPath()
+			if err != nil {
+				return err
+			}
+			if _, err := os.Stat(globalPath); err == nil {
+				report(globalPath, config.ValidateConfigFile(globalPath))
+			}
+			if projectPath, ok := config.FindProjectConfig("."); ok {
+				report(projectPath, config.ValidateConfigFile(projectPath))
+			}
+			report("environment", config.ValidateEnvOverrides())
+
+			if invalid {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("config is invalid")
+			}
+			return nil
+		},
+	}
+)
+
+// configFilePath returns the path of the global config file, or of the project config file of the current
+// repository if project is set. A new project config file goes to the root of the repository.
+func configFilePath(project bool) (string, error) {
+	if !project {
+		return config.ConfigPath()
+	}
+	if path, ok := config.FindProjectConfig("."); ok {
+		return path, nil
+	}
+	repoRoot, err := git.FindRepoRoot(".")
+	if err != nil {
+		return "", fmt.Errorf("project config files belong in a git repository: %w", err)
+	}
+	return filepath.Join(repoRoot, config.ProjectConfigFileName), nil
+}
+
+// editConfigFile opens a copy of the config file at path in the user's editor until it is valid or the
+// user gives up. Only a valid file replaces the original.
+func editConfigFile(path string, project bool) error {
+	original, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	if os.IsNotExist(err) {
+		// Start a new project config from scratch, since it should only hold the keys it overrides.
+		var template any = map[string]any{}
+		if !project {
+			template = config.DefaultConfig()
+		}
+		if original, err = json.MarshalIndent(template, "", "  "); err != nil {
+			return err
+		}
+		original = append(original, '\n')
+	}
+
+	tmp, err := os.CreateTemp("", "claudesquad-config-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+	_, err = tmp.Write(original)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	stdin := bufio.NewReader(os.Stdin)
+	for {
+		// The editor may come with arguments, e.g. "code --wait".
+		fields := strings.Fields(editor)
+		cmd := exec.Command(fields[0], append(fields[1:], tmpPath)...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("editor %q failed: %w", editor, err)
+		}
+
+		edited, err := os.ReadFile(tmpPath)
+		if err != nil {
+			return fmt.Errorf("failed to read edited config: %w", err)
+		}
+		if bytes.Equal(edited, original) {
+			fmt.Println("No changes")
+			return nil
+		}
+		validateErr := config.ValidateConfig(edited)
+		if project {
+			validateErr = config.ValidateProjectConfig(edited)
+		}
+		if validateErr == nil {
+			if err := config.WriteConfigFile(path, edited); err != nil {
+				return err
+			}
+			fmt.Printf("Saved %s\n", path)
+			return nil
+		}
+
+		fmt.Printf("The config is invalid:\n%v\nEdit it again? [Y/n] ", validateErr)
+		answer, err := stdin.ReadString('\n')
+		if err != nil && answer == "" {
+			// Stdin is closed, so we can't ask again.
+			answer = "n"
+		}
+		if a := strings.ToLower(strings.TrimSpace(answer)); a == "n" || a == "no" {
+			return fmt.Errorf("discarded the changes, %s was not modified", path)
+		}
+	}
+}
+
+func init() {
+	configSetCmd.Flags().BoolVar(&configProjectFlag, "project", false,
+		"Write the project config file of the current repository instead of the global one")
+	configEditCmd.Flags().BoolVar(&configProjectFlag, "project", false,
+		"Edit the project config file of the current repository instead of the global one")
+
+	configCmd.AddCommand(configGetCmd, configSetCmd, configEditCmd, configValidateCmd)
+	rootCmd.AddCommand(configCmd)
+}
@@ -0,0 +1,477 @@
+package config
+
+import (
+	"bytes"
+	"claude-squad/log"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// InstancesDBFileName is the database used by the bolt instance storage.
+const InstancesDBFileName = "instances.db"
+
+var (
+	// instancesBucket maps a sequence number, which keeps the instances in the order they were added, to
+	// the JSON record of an instance.
+	instancesBucket = []byte("instances")
+	// indexBucket maps instance IDs to their sequence number.
+	indexBucket = []byte("index")
+	metaBucket  = []byte("meta")
+
+	versionKey  = []byte("version")
+	importedKey = []byte("imported_from_state")
+)
+
+// boltOpenTimeout is how long we wait for other processes to release the database.
+const boltOpenTimeout = 10 * time.Second
+
+// BoltInstanceStorage stores instances in an embedded bolt database with one record per instance, so
+// an update only writes the instances which changed. The database is opened for every operation, since
+// bolt only lets one process open it at a time. This also serializes updates from different processes.
+type BoltInstanceStorage struct {
+	path string
+
+	mu sync.Mutex
+	// cached is the data returned by the last successful read, which is used if reading fails.
+	cached json.RawMessage
+}
+
+// OpenBoltInstanceStorage opens the instance database in the config directory, creating it if needed.
+// The first time, the instances stored in state.json are moved into it. Databases written by older
+// versions are backed up and upgraded with the same migrations as the state file.
+func OpenBoltInstanceStorage() (*BoltInstanceStorage, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config directory: %w", err)
+	}
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	b := &BoltInstanceStorage{path: filepath.Join(configDir, InstancesDBFileName), cached: json.RawMessage("[]")}
+	err = b.update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(instancesBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(indexBucket); err != nil {
+			return err
+		}
+
+		version, err := b.version(tx)
+		if err != nil {
+			return err
+		}
+		if version < CurrentStateVersion {
+			if _, err := backupStateFile(b.path, fmt.Sprintf("v%d.bak", version)); err != nil {
+				return fmt.Errorf("failed to back up %s: %w", b.path, err)
+			}
+			if err := migrateInstanceRecords(tx, version); err != nil {
+				return err
+			}
+		}
+		if err := meta.Put(versionKey, []byte(strconv.Itoa(CurrentStateVersion))); err != nil {
+			return err
+		}
+
+		if meta.Get(importedKey) != nil {
+			return nil
+		}
+		if err := importStateInstances(tx); err != nil {
+			return fmt.Errorf("failed to import instances from %s: %w", StateFileName, err)
+		}
+		return meta.Put(importedKey, []byte(time.Now().Format(time.RFC3339)))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// version returns the version of the database. New databases have CurrentStateVersion.
+func (b *BoltInstanceStorage) version(tx *bolt.Tx) (int, error) {
+	meta := tx.Bucket(metaBucket)
+	if meta == nil || meta.Get(versionKey) == nil {
+		return CurrentStateVersion, nil
+	}
+	v := meta.Get(versionKey)
+	version, err := strconv.Atoi(string(v))
+	if err != nil || version < 0 {
+		return 0, fmt.Errorf("%w: invalid version %q in %s", ErrStateCorrupt, v, b.path)
+	}
+	if version > CurrentStateVersion {
+		return 0, fmt.Errorf("%w: %s has version %d, but this version of claude-squad only supports "+
+			"up to %d", ErrStateTooNew, b.path, version, CurrentStateVersion)
+	}
+	return version, nil
+}
+
+// exportBoltInstances moves the instances of the database back into state.json when the JSON storage is
+// selected again, so they don't seem to be gone. The database is moved to instances.db.exported.bak, so
+// selecting the bolt storage again imports the instances anew.
+func exportBoltInstances(state *State) error {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return fmt.Errorf("failed to get config directory: %w", err)
+	}
+	b := &BoltInstanceStorage{path: filepath.Join(configDir, InstancesDBFileName)}
+	if _, err := os.Stat(b.path); os.IsNotExist(err) {
+		return nil
+	}
+
+	// The state file stays locked until the database is gone, so other processes don't export it again.
+	return state.update(func(state *State) error {
+		if _, err := os.Stat(b.path); os.IsNotExist(err) {
+			return nil
+		}
+		var instancesJSON json.RawMessage
+		err := b.view(func(tx *bolt.Tx) error {
+			version, err := b.version(tx)
+			if err != nil {
+				return err
+			}
+			records, err := readInstanceRecords(tx)
+			if err != nil {
+				return err
+			}
+			instancesJSON, err = migrateInstances(records, version)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		merged, err := mergeInstanceRecords(state.InstancesData, instancesJSON)
+		if err != nil {
+			return err
+		}
+		state.InstancesData = merged
+		return os.Rename(b.path, b.path+".exported.bak")
+	})
+}
+
+// mergeInstanceRecords appends the instances of the JSON array added which aren't in the JSON array
+// instancesJSON yet.
+func mergeInstanceRecords(instancesJSON json.RawMessage, added json.RawMessage) (json.RawMessage, error) {
+	var records, addedRecords []json.RawMessage
+	if err := json.Unmarshal(instancesJSON, &records); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal instances: %w", err)
+	}
+	if err := json.Unmarshal(added, &addedRecords); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal instances: %w", err)
+	}
+	ids := make(map[string]bool, len(records))
+	for _, record := range records {
+		id, err := instanceRecordID(record)
+		if err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	for _, record := range addedRecords {
+		id, err := instanceRecordID(record)
+		if err != nil {
+			return nil, err
+		}
+		if !ids[id] {
+			records = append(records, record)
+		}
+	}
+	return json.Marshal(records)
+}
+
+// migrateInstanceRecords upgrades the stored instances from version to CurrentStateVersion. The records are
+// written from scratch, since migrations may change the IDs they are indexed by.
+func migrateInstanceRecords(tx *bolt.Tx, version int) error {
+	instancesJSON, err := readInstanceRecords(tx)
+	if err != nil {
+		return err
+	}
+	migrated, err := migrateInstances(instancesJSON, version)
+	if err != nil {
+		return err
+	}
+	for _, name := range [][]byte{instancesBucket, indexBucket} {
+		if err := tx.DeleteBucket(name); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucket(name); err != nil {
+			return err
+		}
+	}
+	return writeInstanceRecords(tx, migrated)
+}
+
+// importStateInstances moves the instances stored in state.json into the database. The state file is
+// backed up before its instances are removed, so switching back to the JSON storage doesn't bring back
+// instances which were killed in the meantime.
+func importStateInstances(tx *bolt.Tx) error {
+	_, err := UpdateState(func(state *State) error {
+		if err := writeInstanceRecords(tx, state.InstancesData); err != nil {
+			return err
+		}
+		if bytes.Equal(bytes.TrimSpace(state.InstancesData), []byte("[]")) {
+			return nil
+		}
+		statePath, err := getStatePath()
+		if err != nil {
+			return err
+		}
+		if _, err := backupStateFile(statePath, "imported.bak"); err != nil {
+			return fmt.Errorf("failed to back up state: %w", err)
+		}
+		state.InstancesData = json.RawMessage("[]")
+		return nil
+	})
+	return err
+}
+
+// open opens the database, waiting for other processes to close it.
+func (b *BoltInstanceStorage) open() (*bolt.DB, error) {
+	db, err := bolt.Open(b.path, 0644, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", b.path, err)
+	}
+	return db, nil
+}
+
+func (b *BoltInstanceStorage) update(fn func(tx *bolt.Tx) error) error {
+	db, err := b.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Update(fn)
+}
+
+func (b *BoltInstanceStorage) view(fn func(tx *bolt.Tx) error) error {
+	db, err := b.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.View(fn)
+}
+
+// readInstanceRecords returns the stored instances as a JSON array.
+func readInstanceRecords(tx *bolt.Tx) (json.RawMessage, error) {
+	bucket := tx.Bucket(instancesBucket)
+	if bucket == nil {
+		return nil, fmt.Errorf("%w: missing %s bucket", ErrStateCorrupt, instancesBucket)
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	first := true
+	err := bucket.ForEach(func(_, record []byte) error {
+		if !first {
+			buf.WriteByte(',')
+		}
+		first = false
+		buf.Write(record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// writeInstanceRecords replaces the stored instances with the JSON array instancesJSON. Only records which
+// changed are written. New instances are added after the existing ones.
+func writeInstanceRecords(tx *bolt.Tx, instancesJSON json.RawMessage) error {
+	var records []json.RawMessage
+	if err := json.Unmarshal(instancesJSON, &records); err != nil {
+		return fmt.Errorf("failed to unmarshal instances: %w", err)
+	}
+	bucket, index, err := instanceBuckets(tx)
+	if err != nil {
+		return err
+	}
+
+	kept := make(map[string]bool, len(records))
+	for _, record := range records {
+		record, id, err := compactInstanceRecord(record)
+		if err != nil {
+			return err
+		}
+		if kept[id] {
+			return fmt.Errorf("duplicate instance ID: %s", id)
+		}
+		kept[id] = true
+
+		seq := bytes.Clone(index.Get([]byte(id)))
+		if seq == nil {
+			next, err := bucket.NextSequence()
+			if err != nil {
+				return err
+			}
+			seq = binary.BigEndian.AppendUint64(nil, next)
+			if err := index.Put([]byte(id), seq); err != nil {
+				return err
+			}
+		} else if bytes.Equal(bucket.Get(seq), record) {
+			continue
+		}
+		if err := bucket.Put(seq, record); err != nil {
+			return err
+		}
+	}
+
+	// Collect first, deleting while iterating isn't supported.
+	var removed [][]byte
+	if err := index.ForEach(func(id, _ []byte) error {
+		if !kept[string(id)] {
+			removed = append(removed, bytes.Clone(id))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, id := range removed {
+		if err := bucket.Delete(bytes.Clone(index.Get(id))); err != nil {
+			return err
+		}
+		if err := index.Delete(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compactInstanceRecord returns the JSON record of an instance without formatting, so formatting doesn't make
+// unchanged records look changed, and the ID it is stored under.
+func compactInstanceRecord(record json.RawMessage) ([]byte, string, error) {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, record); err != nil {
+		return nil, "", fmt.Errorf("failed to compact instance: %w", err)
+	}
+	id, err := instanceRecordID(compact.Bytes())
+	if err != nil {
+		return nil, "", err
+	}
+	return compact.Bytes(), id, nil
+}
+
+// instanceBuckets returns the buckets of the instance records and of their index.
+func instanceBuckets(tx *bolt.Tx) (bucket *bolt.Bucket, index *bolt.Bucket, err error) {
+	bucket, index = tx.Bucket(instancesBucket), tx.Bucket(indexBucket)
+	if bucket == nil || index == nil {
+		return nil, nil, fmt.Errorf("%w: missing buckets", ErrStateCorrupt)
+	}
+	return bucket, index, nil
+}
+
+// SaveInstances replaces the stored instances.
+func (b *BoltInstanceStorage) SaveInstances(instancesJSON json.RawMessage) error {
+	return b.UpdateInstances(func(json.RawMessage) (json.RawMessage, error) {
+		return instancesJSON, nil
+	})
+}
+
+// GetInstances returns the stored instances as a JSON array.
+func (b *BoltInstanceStorage) GetInstances() json.RawMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	err := b.view(func(tx *bolt.Tx) error {
+		instancesJSON, err := readInstanceRecords(tx)
+		if err != nil {
+			return err
+		}
+		b.cached = instancesJSON
+		return nil
+	})
+	if err != nil {
+		log.WarningLog.Printf("failed to read instances, using cached instances: %v", err)
+	}
+	return b.cached
+}
+
+// UpdateInstances replaces the stored instances with the result of update in a single transaction.
+func (b *BoltInstanceStorage) UpdateInstances(update func(instancesJSON json.RawMessage) (json.RawMessage, error)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.update(func(tx *bolt.Tx) error {
+		instancesJSON, err := readInstanceRecords(tx)
+		if err != nil {
+			return err
+		}
+		updated, err := update(instancesJSON)
+		if err != nil {
+			return err
+		}
+		if err := writeInstanceRecords(tx, updated); err != nil {
+			return err
+		}
+		b.cached = updated
+		return nil
+	})
+}
+
+// UpdateInstance replaces the record of the instance with the given ID with the result of update. Only this
+// record is read and written.
+func (b *BoltInstanceStorage) UpdateInstance(id string, update func(instanceJSON json.RawMessage) (json.RawMessage, error)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.update(func(tx *bolt.Tx) error {
+		bucket, index, err := instanceBuckets(tx)
+		if err != nil {
+			return err
+		}
+		seq := index.Get([]byte(id))
+		if seq == nil {
+			return fmt.Errorf("%w: %s", ErrInstanceNotFound, id)
+		}
+		updated, err := update(bytes.Clone(bucket.Get(seq)))
+		if err != nil {
+			return err
+		}
+		record, updatedID, err := compactInstanceRecord(updated)
+		if err != nil {
+			return err
+		}
+		if updatedID != id {
+			return fmt.Errorf("cannot change the ID of instance %s to %s", id, updatedID)
+		}
+		return bucket.Put(bytes.Clone(seq), record)
+	})
+}
+
+// DeleteInstance removes the record of the instance with the given ID.
+func (b *BoltInstanceStorage) DeleteInstance(id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.update(func(tx *bolt.Tx) error {
+		bucket, index, err := instanceBuckets(tx)
+		if err != nil {
+			return err
+		}
+		seq := bytes.Clone(index.Get([]byte(id)))
+		if seq == nil {
+			return fmt.Errorf("%w: %s", ErrInstanceNotFound, id)
+		}
+		if err := bucket.Delete(seq); err != nil {
+			return err
+		}
+		return index.Delete([]byte(id))
+	})
+}
+
+// DeleteAllInstances removes all stored instances.
+func (b *BoltInstanceStorage) DeleteAllInstances() error {
+	return b.SaveInstances(json.RawMessage("[]"))
+}
@@ -0,0 +1,195 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+type testInstance struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+func decodeTestInstances(t *testing.T, instancesJSON json.RawMessage) []testInstance {
+	var instances []testInstance
+	require.NoError(t, json.Unmarshal(instancesJSON, &instances))
+	return instances
+}
+
+func TestBoltInstanceStorageImportsState(t *testing.T) {
+	statePath := writeStateFile(t, `{"version":1,"instances":[{"id":"a","title":"first"},{"id":"b","title":"second"}]}`)
+
+	storage, err := OpenBoltInstanceStorage()
+	require.NoError(t, err)
+	assert.Equal(t, []testInstance{{"a", "first"}, {"b", "second"}}, decodeTestInstances(t, storage.GetInstances()))
+
+	// The instances moved, a backup of the state file keeps them.
+	state, err := LoadState()
+	require.NoError(t, err)
+	assert.JSONEq(t, "[]", string(state.GetInstances()))
+	_, err = os.Stat(statePath + ".imported.bak")
+	assert.NoError(t, err)
+
+	// Importing only happens once.
+	require.NoError(t, state.SaveInstances(json.RawMessage(`[{"id":"c","title":"third"}]`)))
+	storage, err = OpenBoltInstanceStorage()
+	require.NoError(t, err)
+	assert.Len(t, decodeTestInstances(t, storage.GetInstances()), 2)
+}
+
+func TestBoltInstanceStorageRecords(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	storage, err := OpenBoltInstanceStorage()
+	require.NoError(t, err)
+
+	require.NoError(t, storage.SaveInstances(json.RawMessage(`[{"id":"a","title":"first"},{"id":"b","title":"second"}]`)))
+	// Renaming, removing and adding keeps the order the instances were added in.
+	require.NoError(t, storage.SaveInstances(json.RawMessage(`[{"id":"b","title":"renamed"},{"id":"c","title":"third"}]`)))
+	assert.Equal(t, []testInstance{{"b", "renamed"}, {"c", "third"}}, decodeTestInstances(t, storage.GetInstances()))
+
+	// A storage opened by another process sees the same records.
+	other, err := OpenBoltInstanceStorage()
+	require.NoError(t, err)
+	assert.Equal(t, []testInstance{{"b", "renamed"}, {"c", "third"}}, decodeTestInstances(t, other.GetInstances()))
+
+	assert.Error(t, storage.SaveInstances(json.RawMessage(`[{"title":"no id"}]`)))
+	assert.Error(t, storage.SaveInstances(json.RawMessage(`[{"id":"d"},{"id":"d"}]`)))
+
+	require.NoError(t, storage.DeleteAllInstances())
+	assert.JSONEq(t, "[]", string(other.GetInstances()))
+}
+
+func TestInstanceStorageUpdatesSingleRecords(t *testing.T) {
+	for name, open := range map[string]func() (InstanceStorage, error){
+		"json": func() (InstanceStorage, error) { return LoadState() },
+		"bolt": func() (InstanceStorage, error) { return OpenBoltInstanceStorage() },
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("HOME", t.TempDir())
+			storage, err := open()
+			require.NoError(t, err)
+			require.NoError(t, storage.SaveInstances(json.RawMessage(`[{"id":"a","title":"first"},{"id":"b","title":"second"}]`)))
+
+			require.NoError(t, storage.UpdateInstance("a", func(json.RawMessage) (json.RawMessage, error) {
+				return json.RawMessage(`{"id":"a","title":"renamed"}`), nil
+			}))
+			assert.Equal(t, []testInstance{{"a", "renamed"}, {"b", "second"}}, decodeTestInstances(t, storage.GetInstances()))
+			assert.Error(t, storage.UpdateInstance("a", func(json.RawMessage) (json.RawMessage, error) {
+				return json.RawMessage(`{"id":"b"}`), nil
+			}))
+
+			require.NoError(t, storage.DeleteInstance("a"))
+			assert.Equal(t, []testInstance{{"b", "second"}}, decodeTestInstances(t, storage.GetInstances()))
+			assert.ErrorIs(t, storage.DeleteInstance("a"), ErrInstanceNotFound)
+			assert.ErrorIs(t, storage.UpdateInstance("a", nil), ErrInstanceNotFound)
+		})
+	}
+}
+
+func TestBoltInstanceStorageMigratesOldVersions(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	storage, err := OpenBoltInstanceStorage()
+	require.NoError(t, err)
+
+	// Write a database as version 0 did, whose instances had no IDs.
+	require.NoError(t, storage.update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(metaBucket).Put(versionKey, []byte("0")); err != nil {
+			return err
+		}
+		return tx.Bucket(instancesBucket).Put([]byte{1}, []byte(`{"title":"old one"}`))
+	}))
+
+	storage, err = OpenBoltInstanceStorage()
+	require.NoError(t, err)
+	assert.Equal(t, []testInstance{{"oldone", "old one"}}, decodeTestInstances(t, storage.GetInstances()))
+	_, err = os.Stat(storage.path + ".v0.bak")
+	assert.NoError(t, err)
+
+	// Records are indexed by their new IDs.
+	require.NoError(t, storage.SaveInstances(json.RawMessage(`[{"id":"oldone","title":"renamed"}]`)))
+	assert.Equal(t, []testInstance{{"oldone", "renamed"}}, decodeTestInstances(t, storage.GetInstances()))
+
+	require.NoError(t, storage.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(metaBucket).Put(versionKey, []byte(fmt.Sprint(CurrentStateVersion+1)))
+	}))
+	_, err = OpenBoltInstanceStorage()
+	assert.ErrorIs(t, err, ErrStateTooNew)
+}
+
+func TestBoltInstanceStorageUpdatesConcurrently(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	const writers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			storage, err := OpenBoltInstanceStorage()
+			require.NoError(t, err)
+			err = storage.UpdateInstances(func(instancesJSON json.RawMessage) (json.RawMessage, error) {
+				var instances []testInstance
+				if err := json.Unmarshal(instancesJSON, &instances); err != nil {
+					return nil, err
+				}
+				id := fmt.Sprintf("instance-%d", i)
+				return json.Marshal(append(instances, testInstance{ID: id, Title: id}))
+			})
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	storage, err := OpenBoltInstanceStorage()
+	require.NoError(t, err)
+	assert.Len(t, decodeTestInstances(t, storage.GetInstances()), writers)
+}
+
+func TestSwitchingBackToJSONExportsInstances(t *testing.T) {
+	writeStateFile(t, `{"version":1,"instances":[{"id":"a","title":"first"}]}`)
+	storage, err := NewInstanceStorage(&Config{InstanceStorage: InstanceStorageBolt}, DefaultState())
+	require.NoError(t, err)
+	require.NoError(t, storage.DeleteInstance("a"))
+	require.NoError(t, storage.SaveInstances(json.RawMessage(`[{"id":"b","title":"second"}]`)))
+
+	// The instances of the database are moved back, and nothing comes back from the import.
+	state, err := LoadState()
+	require.NoError(t, err)
+	storage, err = NewInstanceStorage(&Config{InstanceStorage: InstanceStorageJSON}, state)
+	require.NoError(t, err)
+	assert.Equal(t, []testInstance{{"b", "second"}}, decodeTestInstances(t, storage.GetInstances()))
+	configDir, err := GetConfigDir()
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(configDir, InstancesDBFileName+".exported.bak"))
+	assert.NoError(t, err)
+
+	// Switching to the database again imports them again.
+	require.NoError(t, storage.SaveInstances(json.RawMessage(`[{"id":"b","title":"second"},{"id":"c","title":"third"}]`)))
+	storage, err = NewInstanceStorage(&Config{InstanceStorage: InstanceStorageBolt}, state)
+	require.NoError(t, err)
+	assert.Equal(t, []testInstance{{"b", "second"}, {"c", "third"}}, decodeTestInstances(t, storage.GetInstances()))
+}
+
+func TestNewInstanceStorage(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	state := DefaultState()
+
+	storage, err := NewInstanceStorage(&Config{}, state)
+	require.NoError(t, err)
+	assert.Same(t, state, storage)
+
+	storage, err = NewInstanceStorage(&Config{InstanceStorage: InstanceStorageBolt}, state)
+	require.NoError(t, err)
+	assert.IsType(t, &BoltInstanceStorage{}, storage)
+
+	_, err = NewInstanceStorage(&Config{InstanceStorage: "sqlite"}, state)
+	assert.Error(t, err)
+}
@@ -3,13 +3,34 @@ package config
 import (
 	"claude-squad/log"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 const ConfigFileName = "config.json"
 
+// ProjectConfigFileName is the config file in a repository which overrides the global config for it.
+const ProjectConfigFileName = ".claude-squad.json"
+
+// projectConfigKeys are the keys a project config file can set. The other keys configure claude-squad itself,
+// e.g. where instances are stored, which has to be the same in every repository.
+var projectConfigKeys = map[string]bool{
+	"default_program": true,
+	"branch_prefix":   true,
+	"auto_yes":        true,
+	"companions":      true,
+}
+
+const (
+	// InstanceStorageJSON stores instances in state.json.
+	InstanceStorageJSON = "json"
+	// InstanceStorageBolt stores instances in an embedded database. See BoltInstanceStorage.
+	InstanceStorageBolt = "bolt"
+)
+
 // GetConfigDir returns the path to the application's configuration directory
 func GetConfigDir() (string, error) {
 	homeDir, err := os.UserHomeDir()
@@ -29,6 +50,30 @@ type Config struct {
 	DaemonPollInterval int `json:"daemon_poll_interval"`
 	// BranchPrefix is the prefix used for git branches created by the application.
 	BranchPrefix string `json:"branch_prefix"`
+	// InstanceStorage selects where instances are stored, InstanceStorageJSON or InstanceStorageBolt.
+	// Empty means InstanceStorageJSON.
+	InstanceStorage string `json:"instance_storage,omitempty"`
+	// TmuxSocket is the socket of the tmux server the sessions run on, a name in the tmux socket directory
+	// (tmux -L) or an absolute path (tmux -S).
+	TmuxSocket string `json:"tmux_socket"`
+	// Companions are extra windows in the tmux session of each instance, e.g. a shell or a dev server.
+	Companions []Companion `json:"companions,omitempty"`
+	// RecordSessions records what the program of each instance prints to an asciicast file, which `cs replay`
+	// plays back.
+	RecordSessions bool `json:"record_sessions"`
+}
+
+// AgentWindowName names the window of the tmux session which runs the program of the instance. Companions
+// can't use it.
+const AgentWindowName = "agent"
+
+// Companion is an extra window in the tmux session of each instance, which runs a command in the worktree of
+// the instance next to its program.
+type Companion struct {
+	// Name names the window. It is shown in the preview and selects the window to attach to.
+	Name string `json:"name"`
+	// Command is the command to run in the window. Empty means the default shell.
+	Command string `json:"command,omitempty"`
 }
 
 // DefaultConfig returns the default configuration
@@ -38,40 +83,214 @@ func DefaultConfig() *Config {
 		AutoYes:            false,
 		DaemonPollInterval: 1000,
 		BranchPrefix:       "session/",
+		InstanceStorage:    InstanceStorageJSON,
+		TmuxSocket:         "claudesquad",
 	}
 }
 
-// LoadConfig loads the configuration from disk. If it cannot be done, we return the default configuration.
+// NewInstanceStorage returns the instance storage selected in the config. The JSON storage is state. If the
+// bolt storage was used before, its instances are moved back into state.
+func NewInstanceStorage(config *Config, state *State) (InstanceStorage, error) {
+	switch config.InstanceStorage {
+	case "", InstanceStorageJSON:
+		if err := exportBoltInstances(state); err != nil {
+			return nil, fmt.Errorf("failed to move the instances of %s back to %s: %w", InstancesDBFileName,
+				StateFileName, err)
+		}
+		return state, nil
+	case InstanceStorageBolt:
+		return OpenBoltInstanceStorage()
+	default:
+		return nil, fmt.Errorf("unknown instance storage %q, use %q or %q", config.InstanceStorage,
+			InstanceStorageJSON, InstanceStorageBolt)
+	}
+}
+
+// LoadConfig is LoadConfigFor the current directory. Use it for the keys project config files can't set,
+// and for instances created in the current repository.
 func LoadConfig() *Config {
-	configDir, err := GetConfigDir()
+	return LoadConfigFor(".")
+}
+
+// LoadConfigFor loads the global config file and layers the project config file of the repository
+// containing dir and the CS_* environment variables on top, each overriding the fields the previous one
+// set. Invalid values are logged and ignored, CheckConfig reports them.
+func LoadConfigFor(dir string) *Config {
+	config, err := loadConfig(dir)
 	if err != nil {
-		log.ErrorLog.Printf("failed to get config directory: %v", err)
-		return DefaultConfig()
+		log.WarningLog.Printf("ignoring invalid config values: %v", err)
 	}
+	return config
+}
 
-	configPath := filepath.Join(configDir, ConfigFileName)
-	data, err := os.ReadFile(configPath)
+// CheckConfig returns every problem of the config files and environment variables read by LoadConfig.
+func CheckConfig() error {
+	_, err := loadConfig(".")
+	return err
+}
+
+// loadConfig is LoadConfig for the repository containing dir. Missing fields keep their default value. The
+// problems which were ignored are returned along with the config.
+func loadConfig(dir string) (*Config, error) {
+	config := DefaultConfig()
+	var errs []error
+
+	configPath, err := ConfigPath()
 	if err != nil {
-		if os.IsNotExist(err) {
-			// Create and save default config if file doesn't exist
-			defaultCfg := DefaultConfig()
-			if saveErr := saveConfig(defaultCfg); saveErr != nil {
-				log.WarningLog.Printf("failed to save default config: %v", saveErr)
+		errs = append(errs, err)
+	} else if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		// Create and save default config if file doesn't exist
+		if saveErr := saveConfig(config); saveErr != nil {
+			log.WarningLog.Printf("failed to save default config: %v", saveErr)
+		}
+	} else if err := loadConfigFile(config, configPath); err != nil {
+		errs = append(errs, err)
+	}
+
+	if projectPath, ok := FindProjectConfig(dir); ok {
+		if err := loadConfigFile(config, projectPath); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := applyEnvOverrides(config); err != nil {
+		errs = append(errs, err)
+	}
+	return config, errors.Join(errs...)
+}
+
+// applyEnvOverrides overrides the fields of config whose CS_* environment variable is set. Invalid values
+// are ignored and returned.
+func applyEnvOverrides(config *Config) error {
+	var errs []error
+	for _, key := range ConfigKeys() {
+		name := EnvVarName(key)
+		if value, ok := os.LookupEnv(name); ok {
+			if err := SetConfigValue(config, key, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
 			}
-			return defaultCfg
 		}
+	}
+	return errors.Join(errs...)
+}
+
+// ValidateEnvOverrides returns the invalid values of the CS_* environment variables.
+func ValidateEnvOverrides() error {
+	return applyEnvOverrides(DefaultConfig())
+}
 
-		log.WarningLog.Printf("failed to get config file: %v", err)
-		return DefaultConfig()
+// loadConfigFile overrides the fields of config which are set in the config file at path. Each problem is
+// reported on its own line prefixed with the path.
+func loadConfigFile(config *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+	if err := parseConfigInto(config, data, isProjectConfig(path)); err != nil {
+		return fmt.Errorf("%s: %s", path, strings.ReplaceAll(err.Error(), "\n", "\n"+path+": "))
 	}
+	return nil
+}
 
-	var config Config
-	if err := json.Unmarshal(data, &config); err != nil {
-		log.ErrorLog.Printf("failed to parse config file: %v", err)
-		return DefaultConfig()
+// ValidateConfigFile returns every unknown key, value of the wrong type and impossible value in the config
+// file at path.
+func ValidateConfigFile(path string) error {
+	return loadConfigFile(DefaultConfig(), path)
+}
+
+// ValidateConfig is ValidateConfigFile for the content of the global config file.
+func ValidateConfig(data []byte) error {
+	return parseConfigInto(DefaultConfig(), data, false)
+}
+
+// ValidateProjectConfig is ValidateConfigFile for the content of a project config file.
+func ValidateProjectConfig(data []byte) error {
+	return parseConfigInto(DefaultConfig(), data, true)
+}
+
+// isProjectConfig returns whether the config file at path is a project config file.
+func isProjectConfig(path string) bool {
+	return filepath.Base(path) == ProjectConfigFileName
+}
+
+// SetConfigFileValue sets a key in the config file at path, creating the file if needed. The other keys
+// in the file are left as they are, so a project config file only holds the keys it overrides.
+func SetConfigFileValue(path string, key string, value string) error {
+	fields := map[string]json.RawMessage{}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return fmt.Errorf("%s: invalid JSON: %w", path, err)
+		}
+	}
+
+	config := DefaultConfig()
+	if err := SetConfigValue(config, key, value); err != nil {
+		return err
+	}
+	if isProjectConfig(path) && !projectConfigKeys[key] {
+		return fmt.Errorf("%s can only be set in the global config", key)
+	}
+	field, err := configField(config, key)
+	if err != nil {
+		return err
+	}
+	if fields[key], err = json.Marshal(field.Interface()); err != nil {
+		return err
+	}
+
+	data, err = json.MarshalIndent(fields, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	return WriteConfigFile(path, append(data, '\n'))
+}
+
+// FindProjectConfig returns the path of the project config file for dir. It is looked up in dir and its
+// parents up to the root of the repository.
+func FindProjectConfig(dir string) (string, bool) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	for {
+		path := filepath.Join(dir, ProjectConfigFileName)
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+		// .git is a file in worktrees and a directory otherwise.
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return "", false
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
 	}
+}
 
-	return &config
+// ConfigPath returns the path of the global config file.
+func ConfigPath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get config directory: %w", err)
+	}
+	return filepath.Join(configDir, ConfigFileName), nil
+}
+
+// WriteConfigFile replaces the config file at path atomically, so it is never left half written.
+func WriteConfigFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := WriteFileAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
 }
 
 // saveConfig saves the configuration to disk
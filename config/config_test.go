@@ -0,0 +1,133 @@
+package config
+
+import (
+	"claude-squad/log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfigLayers(t *testing.T) {
+	log.Initialize(false)
+	defer log.Close()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	require.NoError(t, os.MkdirAll(filepath.Join(home, ".claude-squad"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".claude-squad", ConfigFileName),
+		[]byte(`{"default_program": "aider", "auto_yes": true, "daemon_poll_interval": 500, "branch_prefix": "cs/"}`),
+		0644))
+
+	repo := t.TempDir()
+	subdir := filepath.Join(repo, "pkg", "sub")
+	require.NoError(t, os.MkdirAll(subdir, 0755))
+	require.NoError(t, os.Mkdir(filepath.Join(repo, ".git"), 0755))
+
+	// Without a project config, the global config is used.
+	config, err := loadConfig(subdir)
+	require.NoError(t, err)
+	assert.Equal(t, "aider", config.DefaultProgram)
+	assert.Equal(t, "cs/", config.BranchPrefix)
+
+	// The project config only overrides the fields it sets.
+	require.NoError(t, os.WriteFile(filepath.Join(repo, ProjectConfigFileName),
+		[]byte(`{"default_program": "codex", "auto_yes": false}`), 0644))
+	path, ok := FindProjectConfig(subdir)
+	require.True(t, ok)
+	assert.Equal(t, filepath.Join(repo, ProjectConfigFileName), path)
+	config, err = loadConfig(subdir)
+	require.NoError(t, err)
+	assert.Equal(t, "codex", config.DefaultProgram)
+	assert.False(t, config.AutoYes)
+	assert.Equal(t, 500, config.DaemonPollInterval)
+	assert.Equal(t, "cs/", config.BranchPrefix)
+
+	// Keys which configure claude-squad itself can't be set per project.
+	require.NoError(t, os.WriteFile(filepath.Join(repo, ProjectConfigFileName),
+		[]byte(`{"branch_prefix": "proj/", "daemon_poll_interval": 100, "instance_storage": "bolt"}`), 0644))
+	config, err = loadConfig(subdir)
+	assert.ErrorContains(t, err, "daemon_poll_interval: can only be set in the global config")
+	assert.ErrorContains(t, err, "instance_storage: can only be set in the global config")
+	assert.Equal(t, "proj/", config.BranchPrefix)
+	assert.Equal(t, 500, config.DaemonPollInterval)
+	assert.Equal(t, InstanceStorageJSON, config.InstanceStorage)
+
+	// Environment variables override both, invalid values are reported and ignored.
+	t.Setenv("CS_DEFAULT_PROGRAM", "claude --model opus")
+	t.Setenv("CS_DAEMON_POLL_INTERVAL", "soon")
+	config, err = loadConfig(subdir)
+	assert.ErrorContains(t, err, "CS_DAEMON_POLL_INTERVAL: daemon_poll_interval: expected a whole number")
+	assert.Equal(t, "claude --model opus", config.DefaultProgram)
+	assert.Equal(t, 500, config.DaemonPollInterval)
+
+	// Project configs aren't looked up outside of the repository.
+	_, ok = FindProjectConfig(t.TempDir())
+	assert.False(t, ok)
+}
+
+func TestValidateConfig(t *testing.T) {
+	assert.NoError(t, ValidateConfig([]byte(`{"default_program": "aider"}`)))
+
+	err := ValidateConfig([]byte(`{
+		"defualt_program": "aider",
+		"auto_yes": "yes",
+		"daemon_poll_interval": 0,
+		"branch_prefix": "my branch/",
+		"instance_storage": "sqlite",
+		"tmux_socket": "run/cs.sock",
+		"companions": [{"name": "shell"}, {"name": "shell", "command": "npm run dev"}]
+	}`))
+	require.Error(t, err)
+	for _, problem := range []string{
+		`unknown key "defualt_program", did you mean "default_program"?`,
+		`auto_yes: expected true or false, got "yes"`,
+		"daemon_poll_interval: must be a positive number of milliseconds, got 0",
+		`branch_prefix: "my branch/" is not allowed in git branch names`,
+		`instance_storage: must be "json" or "bolt", got "sqlite"`,
+		`tmux_socket: must be a socket name or an absolute path, got "run/cs.sock"`,
+		`companions: companion name "shell" is used more than once`,
+	} {
+		assert.ErrorContains(t, err, problem)
+	}
+
+	assert.ErrorContains(t, ValidateConfig([]byte(`{"auto_yes": true,}`)), "invalid JSON")
+	assert.ErrorContains(t, ValidateConfig([]byte(`{"companions": [{"name": "dev", "cmd": "npm run dev"}]}`)),
+		`unknown field "cmd"`)
+	assert.ErrorContains(t, ValidateConfig([]byte(`{"companions": [{"name": "agent"}]}`)),
+		`companion name "agent" is taken by the window of the program`)
+}
+
+func TestConfigValues(t *testing.T) {
+	config := DefaultConfig()
+	require.NoError(t, SetConfigValue(config, "daemon_poll_interval", "250"))
+	value, err := GetConfigValue(config, "daemon_poll_interval")
+	require.NoError(t, err)
+	assert.Equal(t, "250", value)
+
+	// Invalid values leave the config as it was.
+	assert.Error(t, SetConfigValue(config, "daemon_poll_interval", "0"))
+	assert.Error(t, SetConfigValue(config, "auto_yes", "maybe"))
+	assert.Equal(t, 250, config.DaemonPollInterval)
+	assert.False(t, config.AutoYes)
+
+	// Lists are given as JSON.
+	require.NoError(t, SetConfigValue(config, "companions", `[{"name": "dev", "command": "npm run dev"}]`))
+	assert.Equal(t, []Companion{{Name: "dev", Command: "npm run dev"}}, config.Companions)
+	value, err = GetConfigValue(config, "companions")
+	require.NoError(t, err)
+	assert.Equal(t, `[{"name":"dev","command":"npm run dev"}]`, value)
+
+	// Setting a key in a file keeps the other keys of the file.
+	path := filepath.Join(t.TempDir(), ProjectConfigFileName)
+	require.NoError(t, os.WriteFile(path, []byte(`{"branch_prefix": "agent/"}`), 0644))
+	require.NoError(t, SetConfigFileValue(path, "auto_yes", "true"))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"branch_prefix": "agent/", "auto_yes": true}`, string(data))
+	assert.ErrorContains(t, SetConfigFileValue(path, "tmux_socket", "other"), "can only be set in the global config")
+	assert.ErrorContains(t, ValidateProjectConfig([]byte(`{"record_sessions": true}`)),
+		"record_sessions: can only be set in the global config")
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// CurrentStateVersion is the version of the state file schema this build reads and writes.
+const CurrentStateVersion = 1
+
+var (
+	// ErrStateCorrupt is returned when the state file can't be parsed.
+	ErrStateCorrupt = errors.New("state file is corrupt")
+	// ErrStateTooNew is returned when the state file was written by a newer version of claude-squad.
+	ErrStateTooNew = errors.New("state file was written by a newer version of claude-squad")
+)
+
+// stateMigrations upgrade the raw state file. stateMigrations[i] upgrades version i to version i+1.
+// Files without a version field are version 0.
+var stateMigrations = []func(raw map[string]json.RawMessage) error{
+	migrateStateV0ToV1,
+}
+
+// migrateState parses a state file and upgrades it to CurrentStateVersion. It returns the upgraded
+// state and the version the file had.
+func migrateState(data []byte) (*State, int, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil || raw == nil {
+		if err == nil {
+			err = fmt.Errorf("expected an object")
+		}
+		return nil, 0, fmt.Errorf("%w: %v", ErrStateCorrupt, err)
+	}
+
+	version := 0
+	if v, ok := raw["version"]; ok {
+		if err := json.Unmarshal(v, &version); err != nil {
+			return nil, 0, fmt.Errorf("%w: invalid version: %v", ErrStateCorrupt, err)
+		}
+	}
+	if version > CurrentStateVersion {
+		return nil, version, fmt.Errorf("%w: version %d, this build understands up to %d",
+			ErrStateTooNew, version, CurrentStateVersion)
+	}
+
+	for v := version; v < CurrentStateVersion; v++ {
+		if err := stateMigrations[v](raw); err != nil {
+			return nil, version, fmt.Errorf("%w: failed to migrate from version %d: %v", ErrStateCorrupt, v, err)
+		}
+	}
+	raw["version"] = json.RawMessage(fmt.Sprint(CurrentStateVersion))
+
+	upgraded, err := json.Marshal(raw)
+	if err != nil {
+		return nil, version, err
+	}
+	var state State
+	if err := json.Unmarshal(upgraded, &state); err != nil {
+		return nil, version, fmt.Errorf("%w: %v", ErrStateCorrupt, err)
+	}
+	if state.InstancesData == nil {
+		state.InstancesData = json.RawMessage("[]")
+	}
+	return &state, version, nil
+}
+
+// migrateInstances upgrades the instances of a state with the given version to CurrentStateVersion, for
+// instance storages which keep them outside of the state file.
+func migrateInstances(instancesJSON json.RawMessage, version int) (json.RawMessage, error) {
+	raw := map[string]json.RawMessage{"instances": instancesJSON}
+	for v := version; v < CurrentStateVersion; v++ {
+		if err := stateMigrations[v](raw); err != nil {
+			return nil, fmt.Errorf("%w: failed to migrate from version %d: %v", ErrStateCorrupt, v, err)
+		}
+	}
+	return raw["instances"], nil
+}
+
+var whiteSpaceRegex = regexp.MustCompile(`\s+`)
+
+// migrateStateV0ToV1 gives every instance an ID. Instances were keyed by title before, and their tmux
+// session was named after the title, so the ID is derived from the title the same way the session
+// name was. That way running sessions are found again after upgrading.
+func migrateStateV0ToV1(raw map[string]json.RawMessage) error {
+	instancesJSON, ok := raw["instances"]
+	if !ok || string(instancesJSON) == "null" {
+		return nil
+	}
+	var instances []map[string]json.RawMessage
+	if err := json.Unmarshal(instancesJSON, &instances); err != nil {
+		return fmt.Errorf("invalid instances: %w", err)
+	}
+	for _, instance := range instances {
+		var id, title string
+		if v, ok := instance["id"]; ok {
+			if err := json.Unmarshal(v, &id); err != nil {
+				return fmt.Errorf("invalid instance id: %w", err)
+			}
+		}
+		if id != "" {
+			continue
+		}
+		if err := json.Unmarshal(instance["title"], &title); err != nil {
+			return fmt.Errorf("invalid instance title: %w", err)
+		}
+		id = strings.ReplaceAll(whiteSpaceRegex.ReplaceAllString(title, ""), ".", "_")
+		instance["id"], _ = json.Marshal(id)
+	}
+	migrated, err := json.Marshal(instances)
+	if err != nil {
+		return err
+	}
+	raw["instances"] = migrated
+	return nil
+}
+
+// backupStateFile copies the state file to path.suffix, unless a backup with that name already exists,
+// so the first copy of a file that couldn't be used is kept. It returns the path of the backup.
+func backupStateFile(path string, suffix string) (string, error) {
+	backupPath := path + "." + suffix
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(backupPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return backupPath, nil
+		}
+		return "", err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		os.Remove(backupPath)
+		return "", err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(backupPath)
+		return "", err
+	}
+	return backupPath, nil
+}
@@ -3,9 +3,11 @@ package config
 import (
 	"claude-squad/log"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 )
 
 const (
@@ -19,10 +21,23 @@ type InstanceStorage interface {
 	SaveInstances(instancesJSON json.RawMessage) error
 	// GetInstances returns the raw instance data
 	GetInstances() json.RawMessage
+	// UpdateInstances atomically replaces the raw instance data with the result of update, which receives
+	// the latest stored data. Other processes can't modify the instances in between.
+	UpdateInstances(update func(instancesJSON json.RawMessage) (json.RawMessage, error)) error
+	// UpdateInstance atomically replaces the raw data of the instance with the given ID with the result of
+	// update, which receives the latest stored data of the instance. It returns ErrInstanceNotFound if there
+	// is no such instance.
+	UpdateInstance(id string, update func(instanceJSON json.RawMessage) (json.RawMessage, error)) error
+	// DeleteInstance removes the instance with the given ID. It returns ErrInstanceNotFound if there is no
+	// such instance.
+	DeleteInstance(id string) error
 	// DeleteAllInstances removes all stored instances
 	DeleteAllInstances() error
 }
 
+// ErrInstanceNotFound is returned when there is no stored instance with the requested ID.
+var ErrInstanceNotFound = errors.New("instance not found")
+
 // AppState handles application-level state
 type AppState interface {
 	// GetHelpScreensSeen returns the bitmask of seen help screens
@@ -39,6 +54,8 @@ type StateManager interface {
 
 // State represents the application state that persists between sessions
 type State struct {
+	// Version is the schema version of the state file. See CurrentStateVersion.
+	Version int `json:"version"`
 	// HelpScreensSeen is a bitmask tracking which help screens have been shown
 	HelpScreensSeen uint32 `json:"help_screens_seen"`
 	// Instances stores the serialized instance data as raw JSON
@@ -48,81 +65,292 @@ type State struct {
 // DefaultState returns the default state
 func DefaultState() *State {
 	return &State{
+		Version:         CurrentStateVersion,
 		HelpScreensSeen: 0,
 		InstancesData:   json.RawMessage("[]"),
 	}
 }
 
-// LoadState loads the state from disk. If it cannot be done, we return the default state.
-func LoadState() *State {
-	configDir, err := GetConfigDir()
+// LoadState loads the state from disk, upgrading files written by older versions. A missing file is
+// created with the default state. If the file is corrupt or was written by a newer version, it is backed
+// up and an error is returned. The file is never overwritten in that case.
+func LoadState() (*State, error) {
+	statePath, err := getStatePath()
 	if err != nil {
-		log.ErrorLog.Printf("failed to get config directory: %v", err)
-		return DefaultState()
+		return nil, err
 	}
 
-	statePath := filepath.Join(configDir, StateFileName)
-	data, err := os.ReadFile(statePath)
+	if _, err := os.Stat(statePath); os.IsNotExist(err) {
+		// Create and save default state if file doesn't exist. Going through UpdateState doesn't overwrite
+		// a file another process created in the meantime.
+		return UpdateState(func(*State) error { return nil })
+	}
+
+	state, _, err := readState(statePath)
 	if err != nil {
-		if os.IsNotExist(err) {
-			// Create and save default state if file doesn't exist
-			defaultState := DefaultState()
-			if saveErr := SaveState(defaultState); saveErr != nil {
-				log.WarningLog.Printf("failed to save default state: %v", saveErr)
-			}
-			return defaultState
+		if !errors.Is(err, ErrStateCorrupt) && !errors.Is(err, ErrStateTooNew) {
+			return nil, err
 		}
-
-		log.WarningLog.Printf("failed to get state file: %v", err)
-		return DefaultState()
+		backupPath, backupErr := backupStateFile(statePath, "unreadable.bak")
+		if backupErr != nil {
+			return nil, fmt.Errorf("%w (failed to back it up: %v)", err, backupErr)
+		}
+		return nil, fmt.Errorf("%w. It was left untouched and backed up to %s. Upgrade claude-squad, or repair "+
+			"or remove the file and run the command again", err, backupPath)
 	}
+	return state, nil
+}
 
-	var state State
-	if err := json.Unmarshal(data, &state); err != nil {
-		log.ErrorLog.Printf("failed to parse state file: %v", err)
-		return DefaultState()
+// ResetState replaces the state file with the default state, even if it can't be read. This is how
+// `cs reset` recovers from a corrupt state file, so the file is backed up first.
+func ResetState() (*State, error) {
+	statePath, err := getStatePath()
+	if err != nil {
+		return nil, err
 	}
-
-	return &state
+	if _, err := os.Stat(statePath); err == nil {
+		if _, err := backupStateFile(statePath, "reset.bak"); err != nil {
+			return nil, fmt.Errorf("failed to back up state: %w", err)
+		}
+	}
+	unlock, err := lockFile(statePath + ".lock")
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock state: %w", err)
+	}
+	defer unlock()
+	state := DefaultState()
+	if err := writeState(statePath, state); err != nil {
+		return nil, err
+	}
+	return state, nil
 }
 
-// SaveState saves the state to disk
+// SaveState saves the state to disk, replacing whatever is stored. Prefer UpdateState, which doesn't
+// discard changes made by other processes.
 func SaveState(state *State) error {
-	configDir, err := GetConfigDir()
+	_, err := UpdateState(func(stored *State) error {
+		*stored = *state
+		return nil
+	})
+	return err
+}
+
+// UpdateState applies update to the state currently on disk and saves the result. The state file is
+// locked in between, so concurrent updates from other processes are never lost, and the file is
+// replaced atomically, so a crash can't leave it half-written. The updated state is returned.
+func UpdateState(update func(state *State) error) (*State, error) {
+	statePath, err := getStatePath()
 	if err != nil {
-		return fmt.Errorf("failed to get config directory: %w", err)
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(statePath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create config directory: %w", err)
 	}
 
-	if err := os.MkdirAll(configDir, 0755); err != nil {
-		return fmt.Errorf("failed to create config directory: %w", err)
+	unlock, err := lockFile(statePath + ".lock")
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock state: %w", err)
+	}
+	defer unlock()
+
+	state, version, err := readState(statePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := update(state); err != nil {
+		return nil, err
 	}
 
-	statePath := filepath.Join(configDir, StateFileName)
+	if version < CurrentStateVersion {
+		// Keep the file as the older version wrote it, so downgrading is possible.
+		if _, err := backupStateFile(statePath, fmt.Sprintf("v%d.bak", version)); err != nil {
+			return nil, fmt.Errorf("failed to back up state before upgrading it: %w", err)
+		}
+	}
+	if err := writeState(statePath, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// writeState replaces the state file with state.
+func writeState(statePath string, state *State) error {
+	state.Version = CurrentStateVersion
 	data, err := json.MarshalIndent(state, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal state: %w", err)
 	}
+	if err := WriteFileAtomic(statePath, data, 0644); err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+	return nil
+}
+
+func getStatePath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get config directory: %w", err)
+	}
+	return filepath.Join(configDir, StateFileName), nil
+}
+
+// readState reads the state file and upgrades it to the current version. It also returns the version
+// the file had. A missing file yields the default state.
+func readState(statePath string) (*State, int, error) {
+	data, err := os.ReadFile(statePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return DefaultState(), CurrentStateVersion, nil
+		}
+		return nil, 0, fmt.Errorf("failed to get state file: %w", err)
+	}
+	return migrateState(data)
+}
 
-	return os.WriteFile(statePath, data, 0644)
+// WriteFileAtomic writes data to a temporary file next to path and renames it over path, so readers see
+// either the old or the new content.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
 }
 
 // InstanceStorage interface implementation
 
+// update applies fn to the state on disk and refreshes s with the result.
+func (s *State) update(fn func(state *State) error) error {
+	state, err := UpdateState(fn)
+	if err != nil {
+		return err
+	}
+	*s = *state
+	return nil
+}
+
 // SaveInstances saves the raw instance data
 func (s *State) SaveInstances(instancesJSON json.RawMessage) error {
-	s.InstancesData = instancesJSON
-	return SaveState(s)
+	return s.update(func(state *State) error {
+		state.InstancesData = instancesJSON
+		return nil
+	})
+}
+
+// UpdateInstances replaces the raw instance data with the result of update, which receives the data
+// currently on disk.
+func (s *State) UpdateInstances(update func(instancesJSON json.RawMessage) (json.RawMessage, error)) error {
+	return s.update(func(state *State) error {
+		instancesJSON, err := update(state.InstancesData)
+		if err != nil {
+			return err
+		}
+		state.InstancesData = instancesJSON
+		return nil
+	})
 }
 
-// GetInstances returns the raw instance data
+// UpdateInstance replaces the raw data of the instance with the given ID with the result of update. The state
+// file holds all instances, so all of them are rewritten.
+func (s *State) UpdateInstance(id string, update func(instanceJSON json.RawMessage) (json.RawMessage, error)) error {
+	return s.updateInstanceRecords(id, func(records []json.RawMessage, i int) ([]json.RawMessage, error) {
+		updated, err := update(records[i])
+		if err != nil {
+			return nil, err
+		}
+		updatedID, err := instanceRecordID(updated)
+		if err != nil {
+			return nil, err
+		}
+		if updatedID != id {
+			return nil, fmt.Errorf("cannot change the ID of instance %s to %s", id, updatedID)
+		}
+		records[i] = updated
+		return records, nil
+	})
+}
+
+// DeleteInstance removes the instance with the given ID.
+func (s *State) DeleteInstance(id string) error {
+	return s.updateInstanceRecords(id, func(records []json.RawMessage, i int) ([]json.RawMessage, error) {
+		return slices.Delete(records, i, i+1), nil
+	})
+}
+
+// updateInstanceRecords applies update to the stored instance records, of which the one with the given ID is
+// at index i.
+func (s *State) updateInstanceRecords(id string, update func(records []json.RawMessage, i int) ([]json.RawMessage, error)) error {
+	return s.UpdateInstances(func(instancesJSON json.RawMessage) (json.RawMessage, error) {
+		var records []json.RawMessage
+		if err := json.Unmarshal(instancesJSON, &records); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal instances: %w", err)
+		}
+		for i, record := range records {
+			recordID, err := instanceRecordID(record)
+			if err != nil {
+				return nil, err
+			}
+			if recordID != id {
+				continue
+			}
+			if records, err = update(records, i); err != nil {
+				return nil, err
+			}
+			return json.Marshal(records)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrInstanceNotFound, id)
+	})
+}
+
+// instanceRecordID returns the ID of the JSON record of an instance.
+func instanceRecordID(record json.RawMessage) (string, error) {
+	var key struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(record, &key); err != nil {
+		return "", fmt.Errorf("failed to unmarshal instance: %w", err)
+	}
+	if key.ID == "" {
+		return "", fmt.Errorf("cannot store instance without an ID")
+	}
+	return key.ID, nil
+}
+
+// GetInstances returns the raw instance data. It is read from disk again to pick up the changes of
+// other processes.
 func (s *State) GetInstances() json.RawMessage {
+	statePath, err := getStatePath()
+	if err == nil {
+		var state *State
+		if state, _, err = readState(statePath); err == nil {
+			*s = *state
+		}
+	}
+	if err != nil {
+		log.WarningLog.Printf("failed to reload state, using cached instances: %v", err)
+	}
 	return s.InstancesData
 }
 
 // DeleteAllInstances removes all stored instances
 func (s *State) DeleteAllInstances() error {
-	s.InstancesData = json.RawMessage("[]")
-	return SaveState(s)
+	return s.SaveInstances(json.RawMessage("[]"))
 }
 
 // AppState interface implementation
@@ -134,6 +362,8 @@ func (s *State) GetHelpScreensSeen() uint32 {
 
 // SetHelpScreensSeen updates the bitmask of seen help screens
 func (s *State) SetHelpScreensSeen(seen uint32) error {
-	s.HelpScreensSeen = seen
-	return SaveState(s)
+	return s.update(func(state *State) error {
+		state.HelpScreensSeen = seen
+		return nil
+	})
 }
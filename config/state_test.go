@@ -0,0 +1,107 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateInstancesConcurrently(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	// Every writer has its own State, like separate processes would.
+	const writers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			state, err := LoadState()
+			require.NoError(t, err)
+			err = state.UpdateInstances(func(instancesJSON json.RawMessage) (json.RawMessage, error) {
+				var titles []string
+				if err := json.Unmarshal(instancesJSON, &titles); err != nil {
+					return nil, err
+				}
+				return json.Marshal(append(titles, fmt.Sprintf("instance-%d", i)))
+			})
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	state, err := LoadState()
+	require.NoError(t, err)
+	var titles []string
+	require.NoError(t, json.Unmarshal(state.GetInstances(), &titles))
+	assert.Len(t, titles, writers)
+}
+
+func TestUpdateStateKeepsUnreadableFile(t *testing.T) {
+	statePath := writeStateFile(t, "{not json")
+
+	err := DefaultState().SaveInstances(json.RawMessage("[]"))
+	assert.Error(t, err)
+
+	data, err := os.ReadFile(statePath)
+	require.NoError(t, err)
+	assert.Equal(t, "{not json", string(data))
+}
+
+func TestLoadStateMigratesLegacyFile(t *testing.T) {
+	statePath := writeStateFile(t, `{"help_screens_seen":3,"instances":[{"title":"my feature.v2","program":"claude"}]}`)
+
+	state, err := LoadState()
+	require.NoError(t, err)
+	assert.Equal(t, CurrentStateVersion, state.Version)
+	assert.Equal(t, uint32(3), state.HelpScreensSeen)
+	// Legacy instances keep the tmux session name they were created with.
+	assert.JSONEq(t, `[{"id":"myfeature_v2","title":"my feature.v2","program":"claude"}]`,
+		string(state.InstancesData))
+
+	// The first write upgrades the file, keeping a copy of the old one.
+	require.NoError(t, state.SetHelpScreensSeen(7))
+	data, err := os.ReadFile(statePath)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"version": 1`)
+	_, err = os.Stat(statePath + ".v0.bak")
+	assert.NoError(t, err)
+}
+
+func TestLoadStateRefusesUnreadableFiles(t *testing.T) {
+	for name, content := range map[string]string{
+		"corrupt": "{not json",
+		"too new": `{"version":999,"instances":[]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			statePath := writeStateFile(t, content)
+
+			_, err := LoadState()
+			assert.Error(t, err)
+
+			data, err := os.ReadFile(statePath)
+			require.NoError(t, err)
+			assert.Equal(t, content, string(data))
+			backup, err := os.ReadFile(statePath + ".unreadable.bak")
+			require.NoError(t, err)
+			assert.Equal(t, content, string(backup))
+		})
+	}
+}
+
+// writeStateFile writes a state file into a fresh home directory and returns its path.
+func writeStateFile(t *testing.T, content string) string {
+	t.Setenv("HOME", t.TempDir())
+	configDir, err := GetConfigDir()
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(configDir, 0755))
+	statePath := filepath.Join(configDir, StateFileName)
+	require.NoError(t, os.WriteFile(statePath, []byte(content), 0644))
+	return statePath
+}
@@ -0,0 +1,272 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// configValidators check the values of config keys which not every value of their type makes sense for.
+var configValidators = map[string]func(config *Config) error{
+	"default_program": func(config *Config) error {
+		if strings.TrimSpace(config.DefaultProgram) == "" {
+			return fmt.Errorf("cannot be empty")
+		}
+		return nil
+	},
+	"daemon_poll_interval": func(config *Config) error {
+		if config.DaemonPollInterval <= 0 {
+			return fmt.Errorf("must be a positive number of milliseconds, got %d", config.DaemonPollInterval)
+		}
+		return nil
+	},
+	"branch_prefix": func(config *Config) error {
+		prefix := config.BranchPrefix
+		if strings.HasPrefix(prefix, "/") || strings.HasPrefix(prefix, "-") || strings.Contains(prefix, "..") ||
+			strings.Contains(prefix, "//") || strings.ContainsAny(prefix, " \t~^:?*[\\") {
+			return fmt.Errorf("%q is not allowed in git branch names", prefix)
+		}
+		return nil
+	},
+	"instance_storage": func(config *Config) error {
+		switch config.InstanceStorage {
+		case "", InstanceStorageJSON, InstanceStorageBolt:
+			return nil
+		}
+		return fmt.Errorf("must be %q or %q, got %q", InstanceStorageJSON, InstanceStorageBolt, config.InstanceStorage)
+	},
+	"companions": validateCompanions,
+	"tmux_socket": func(config *Config) error {
+		socket := config.TmuxSocket
+		if strings.TrimSpace(socket) == "" {
+			return fmt.Errorf("cannot be empty")
+		}
+		if strings.Contains(socket, "/") && !filepath.IsAbs(socket) {
+			return fmt.Errorf("must be a socket name or an absolute path, got %q", socket)
+		}
+		return nil
+	},
+}
+
+// companionNameRegex matches the names companions can have. They name tmux windows, and tmux treats some
+// characters in targets specially and names made of digits as window indexes.
+var companionNameRegex = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+func validateCompanions(config *Config) error {
+	seen := make(map[string]bool)
+	for _, companion := range config.Companions {
+		switch {
+		case !companionNameRegex.MatchString(companion.Name):
+			return fmt.Errorf("companion name %q must start with a letter and only contain letters, digits, - and _",
+				companion.Name)
+		case companion.Name == AgentWindowName:
+			return fmt.Errorf("companion name %q is taken by the window of the program", companion.Name)
+		case seen[companion.Name]:
+			return fmt.Errorf("companion name %q is used more than once", companion.Name)
+		}
+		seen[companion.Name] = true
+	}
+	return nil
+}
+
+// ConfigKeys returns the keys of the config file in the order of the Config fields.
+func ConfigKeys() []string {
+	t := reflect.TypeOf(Config{})
+	keys := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		keys = append(keys, configKey(t.Field(i)))
+	}
+	return keys
+}
+
+// EnvVarName returns the environment variable which overrides a config key.
+func EnvVarName(key string) string {
+	return "CS_" + strings.ToUpper(key)
+}
+
+func configKey(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	return name
+}
+
+// configField returns the field of config stored under key.
+func configField(config *Config, key string) (reflect.Value, error) {
+	v := reflect.ValueOf(config).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if configKey(v.Type().Field(i)) == key {
+			return v.Field(i), nil
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("unknown key %q%s", key, suggestKey(key))
+}
+
+// suggestKey returns a hint naming the known key which is closest to key, if any is close.
+func suggestKey(key string) string {
+	best, bestDistance := "", 3
+	for _, known := range ConfigKeys() {
+		if d := editDistance(strings.ToLower(key), known); d < bestDistance {
+			best, bestDistance = known, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean %q?", best)
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// typeName describes the JSON type of a config field for error messages.
+func typeName(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int:
+		return "a whole number"
+	case reflect.Slice:
+		return "a JSON list"
+	default:
+		return "a string"
+	}
+}
+
+// setConfigField sets the field stored under key with set and validates it. The field keeps its value if
+// set fails or the new value is invalid. value is the new value as written by the user.
+func setConfigField(config *Config, key string, value string, set func(field reflect.Value) error) error {
+	field, err := configField(config, key)
+	if err != nil {
+		return err
+	}
+	old := reflect.New(field.Type()).Elem()
+	old.Set(field)
+	if err := set(field); err != nil {
+		field.Set(old)
+		if field.Kind() == reflect.Slice {
+			// Say what is wrong inside the list, e.g. a misspelled field.
+			return fmt.Errorf("%s: expected %s, got %s: %v", key, typeName(field.Kind()), value, err)
+		}
+		return fmt.Errorf("%s: expected %s, got %s", key, typeName(field.Kind()), value)
+	}
+	if validate, ok := configValidators[key]; ok {
+		if err := validate(config); err != nil {
+			field.Set(old)
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// parseConfigInto overrides the fields of config which are set in data, the content of a config file.
+// Every unknown key, value of the wrong type and impossible value is reported, and the fields they are
+// for keep their previous value. A project config file can only set the projectConfigKeys.
+func parseConfigInto(config *Config, data []byte, project bool) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, key := range keys {
+		value := fields[key]
+		if _, err := configField(config, key); err == nil && project && !projectConfigKeys[key] {
+			errs = append(errs, fmt.Errorf("%s: can only be set in the global config", key))
+			continue
+		}
+		err := setConfigField(config, key, string(value), func(field reflect.Value) error {
+			return decodeStrict(value, field.Addr().Interface())
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// decodeStrict is json.Unmarshal, except that unknown fields of objects are errors.
+func decodeStrict(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if decoder.More() {
+		return fmt.Errorf("unexpected data after the value")
+	}
+	return nil
+}
+
+// GetConfigValue returns the value of a config key as it would be passed to SetConfigValue.
+func GetConfigValue(config *Config, key string) (string, error) {
+	field, err := configField(config, key)
+	if err != nil {
+		return "", err
+	}
+	if field.Kind() == reflect.Slice {
+		if field.Len() == 0 {
+			return "[]", nil
+		}
+		data, err := json.Marshal(field.Interface())
+		return string(data), err
+	}
+	return fmt.Sprint(field.Interface()), nil
+}
+
+// SetConfigValue parses value according to the type of the config key and sets it if it is valid. Lists are
+// given as JSON.
+func SetConfigValue(config *Config, key string, value string) error {
+	return setConfigField(config, key, strconv.Quote(value), func(field reflect.Value) error {
+		switch field.Kind() {
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return err
+			}
+			field.SetBool(b)
+		case reflect.Int:
+			i, err := strconv.Atoi(value)
+			if err != nil {
+				return err
+			}
+			field.SetInt(int64(i))
+		case reflect.Slice:
+			list := reflect.New(field.Type())
+			if err := decodeStrict([]byte(value), list.Interface()); err != nil {
+				return err
+			}
+			field.Set(list.Elem())
+		default:
+			field.SetString(value)
+		}
+		return nil
+	})
+}
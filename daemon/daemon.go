@@ -1,6 +1,7 @@
 package daemon
 
 import (
+	"claude-squad/api"
 	"claude-squad/config"
 	"claude-squad/log"
 	"claude-squad/session"
@@ -18,19 +19,44 @@ import (
 // It's expected that the main process kills the daemon when the main process starts.
 func RunDaemon(cfg *config.Config) error {
 	log.InfoLog.Printf("starting daemon")
-	state := config.LoadState()
-	storage, err := session.NewStorage(state)
+	storage, err := session.LoadStorage(cfg)
 	if err != nil {
-		return fmt.Errorf("failed to initialize storage: %w", err)
+		return err
 	}
 
-	instances, err := storage.LoadInstances()
+	loadInstances := func() ([]*session.Instance, error) {
+		instances, err := storage.LoadInstances()
+		if err != nil {
+			return nil, err
+		}
+		for _, instance := range instances {
+			// Assume AutoYes is true if the daemon is running.
+			instance.AutoYes = true
+		}
+		return instances, nil
+	}
+	instances, err := loadInstances()
 	if err != nil {
 		return fmt.Errorf("failed to load instacnes: %w", err)
 	}
-	for _, instance := range instances {
-		// Assume AutoYes is true if the daemon is running.
-		instance.AutoYes = true
+
+	// Serve the control API. Changes made through it are picked up by reloading the instances.
+	reloadCh := make(chan struct{}, 1)
+	// The daemon doesn't belong to a repository, so new instances start the default program of theirs.
+	server, err := api.Serve("", func() {
+		select {
+		case reloadCh <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		log.WarningLog.Printf("control API is not available: %v", err)
+	} else {
+		defer func() {
+			if err := server.Close(); err != nil {
+				log.ErrorLog.Printf("failed to close control API server: %v", err)
+			}
+		}()
 	}
 
 	pollInterval := time.Duration(cfg.DaemonPollInterval) * time.Millisecond
@@ -45,18 +71,50 @@ func RunDaemon(cfg *config.Config) error {
 		defer wg.Done()
 		ticker := time.NewTimer(pollInterval)
 		for {
+			select {
+			case <-reloadCh:
+				reloaded, err := loadInstances()
+				if err != nil {
+					log.ErrorLog.Printf("failed to reload instances: %v", err)
+					break
+				}
+				for _, instance := range instances {
+					if err := instance.Disconnect(); err != nil {
+						log.WarningLog.Printf("failed to disconnect from %s: %v", instance.Title, err)
+					}
+				}
+				instances = reloaded
+			default:
+			}
+
+			observations := make([]api.Observation, 0, len(instances))
 			for _, instance := range instances {
 				// We only store started instances, but check anyway.
-				if instance.Started() && !instance.Paused() {
-					if _, hasPrompt := instance.HasUpdated(); hasPrompt {
-						instance.TapEnter()
-						if err := instance.UpdateDiffStats(); err != nil {
-							if everyN.ShouldLog() {
-								log.WarningLog.Printf("could not update diff stats for %s: %v", instance.Title, err)
-							}
+				if !instance.Started() || instance.Paused() || instance.Lost() {
+					observations = append(observations, api.Observation{Instance: instance})
+					continue
+				}
+				updated, hasPrompt := instance.HasUpdated()
+				if updated {
+					instance.SetStatus(session.Running)
+				} else if !hasPrompt {
+					instance.SetStatus(session.Ready)
+				}
+				if hasPrompt {
+					instance.TapEnter()
+				}
+				// Diff stats feed the event stream, so keep them current while it's being served.
+				if hasPrompt || server != nil {
+					if err := instance.UpdateDiffStats(); err != nil {
+						if everyN.ShouldLog() {
+							log.WarningLog.Printf("could not update diff stats for %s: %v", instance.Title, err)
 						}
 					}
 				}
+				observations = append(observations, api.Observation{Instance: instance, Prompt: hasPrompt})
+			}
+			if server != nil {
+				server.Observe(observations)
 			}
 
 			// Handle stop before ticker.
@@ -126,6 +184,27 @@ func LaunchDaemon() error {
 	return nil
 }
 
+// RestartDaemon restarts the daemon if one is running. The daemon only loads instances on startup, so
+// this is how instances created outside of the TUI get picked up. It's a noop if no daemon is running.
+func RestartDaemon() error {
+	pidDir, err := config.GetConfigDir()
+	if err != nil {
+		return fmt.Errorf("failed to get config directory: %w", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(pidDir, "daemon.pid")); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to check PID file: %w", err)
+	}
+
+	if err := StopDaemon(); err != nil {
+		return err
+	}
+	return LaunchDaemon()
+}
+
 // StopDaemon attempts to stop a running daemon process if it exists. Returns no error if the daemon is not found
 // (assumes the daemon does not exist).
 func StopDaemon() error {
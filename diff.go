@@ -0,0 +1,86 @@
+package main
+
+import (
+	"claude-squad/api"
+	"claude-squad/log"
+	"claude-squad/session"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	diffStatFlag     bool
+	diffNameOnlyFlag bool
+	diffJSONFlag     bool
+
+	diffCmd = &cobra.Command{
+		Use:   "diff <title|index>",
+		Short: "Print the changes made by an instance",
+		Long: "Print the changes made by an instance since its base commit. By default the full patch is " +
+			"printed, which can be piped to git apply. Paused instances are diffed from their preserved branch.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.CloseSilently()
+
+			storage, err := loadStorage()
+			if err != nil {
+				return err
+			}
+			instancesData, err := storage.LoadInstanceData()
+			if err != nil {
+				return err
+			}
+			data, err := findInstanceData(instancesData, args[0])
+			if err != nil {
+				return err
+			}
+			if data.Worktree.BaseCommitSHA == "" {
+				return fmt.Errorf("instance %s has no base commit recorded", data.Title)
+			}
+
+			worktree := data.GitWorktree()
+			diff := worktree.DiffWorktree
+			if data.Status == session.Paused {
+				diff = worktree.DiffBranch
+			}
+
+			switch {
+			case diffStatFlag:
+				return printDiff(diff("--stat"))
+			case diffNameOnlyFlag:
+				return printDiff(diff("--name-only"))
+			case diffJSONFlag:
+				out, err := api.DiffInstanceData(data)
+				if err != nil {
+					return err
+				}
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(out)
+			default:
+				return printDiff(diff("--binary"))
+			}
+		},
+	}
+)
+
+func printDiff(output string, err error) error {
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Print(output)
+	return err
+}
+
+func init() {
+	diffCmd.Flags().BoolVar(&diffStatFlag, "stat", false, "Print the number of changed lines per file")
+	diffCmd.Flags().BoolVar(&diffNameOnlyFlag, "name-only", false, "Print only the names of changed files")
+	diffCmd.Flags().BoolVar(&diffJSONFlag, "json", false, "Print per-file statistics and the patch as JSON")
+	diffCmd.MarkFlagsMutuallyExclusive("stat", "name-only", "json")
+
+	rootCmd.AddCommand(diffCmd)
+}
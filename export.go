@@ -0,0 +1,124 @@
+package main
+
+import (
+	"claude-squad/daemon"
+	"claude-squad/log"
+	"claude-squad/session"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportOutputFlag string
+	importPathFlag   string
+	importTitleFlag  string
+	importBranchFlag string
+
+	exportCmd = &cobra.Command{
+		Use:   "export <title|index>",
+		Short: "Export an instance to a file which can be imported elsewhere",
+		Long: "Export an instance to a gzipped tar archive holding a git bundle of its branch since the base " +
+			"commit, the instance itself, the prompts sent to it and its scrollback. Uncommitted changes are " +
+			"included as an extra commit; the branch itself is left untouched. Import the archive with " +
+			"`cs import` in another clone of the repository.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.CloseSilently()
+
+			storage, err := loadStorage()
+			if err != nil {
+				return err
+			}
+			instancesData, err := storage.LoadInstanceData()
+			if err != nil {
+				return err
+			}
+			data, err := findInstanceData(instancesData, args[0])
+			if err != nil {
+				return err
+			}
+
+			if exportOutputFlag == "-" {
+				return storage.ExportInstance(data, os.Stdout)
+			}
+			output := exportOutputFlag
+			if output == "" {
+				output = strings.ReplaceAll(data.Branch, "/", "-") + ".cs.tar.gz"
+			}
+			f, err := os.Create(output)
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %w", output, err)
+			}
+			err = storage.ExportInstance(data, f)
+			if closeErr := f.Close(); err == nil && closeErr != nil {
+				err = fmt.Errorf("failed to write %s: %w", output, closeErr)
+			}
+			if err != nil {
+				os.Remove(output)
+				return err
+			}
+			fmt.Printf("Exported %s to %s\n", data.Title, output)
+			return nil
+		},
+	}
+
+	importCmd = &cobra.Command{
+		Use:   "import <file>",
+		Short: "Import an exported instance as a paused instance",
+		Long: "Import an instance exported with `cs export`. Its branch is created from the bundle and checked " +
+			"out into a new worktree, and the instance is registered as paused; resume it to start its " +
+			"program. The repository must contain the base commit of the instance. Existing branches are " +
+			"never overwritten.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.CloseSilently()
+
+			storage, err := loadStorage()
+			if err != nil {
+				return err
+			}
+
+			f, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to open %s: %w", args[0], err)
+			}
+			defer f.Close()
+			data, err := storage.ImportInstance(f, session.ImportOptions{
+				Path:   importPathFlag,
+				Title:  importTitleFlag,
+				Branch: importBranchFlag,
+			})
+			if err != nil {
+				return err
+			}
+
+			// The daemon keeps its own copy of the instances, so let it reload them.
+			if err := daemon.RestartDaemon(); err != nil {
+				log.ErrorLog.Printf("failed to restart daemon: %v", err)
+			}
+
+			fmt.Printf("Imported %s on branch %s with %d prompts. Resume it with `cs resume %s`\n",
+				data.Title, data.Branch, len(data.Prompts), data.Title)
+			return nil
+		},
+	}
+)
+
+func init() {
+	exportCmd.Flags().StringVarP(&exportOutputFlag, "output", "o", "",
+		"File to write the archive to, or - for stdout (defaults to <branch>.cs.tar.gz)")
+
+	importCmd.Flags().StringVar(&importPathFlag, "path", ".",
+		"Path within the git repository to import the instance into")
+	importCmd.Flags().StringVarP(&importTitleFlag, "title", "t", "",
+		"Title of the imported instance (defaults to the exported title)")
+	importCmd.Flags().StringVarP(&importBranchFlag, "branch", "b", "",
+		"Name of the branch to create (defaults to the exported branch name)")
+
+	rootCmd.AddCommand(exportCmd, importCmd)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"claude-squad/log"
+	"claude-squad/session"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	historySearchFlag     string
+	historyJSONFlag       bool
+	historyDiffFlag       bool
+	historyScrollbackFlag bool
+	historyBranchFlag     string
+
+	historyCmd = &cobra.Command{
+		Use:   "history",
+		Short: "List and search killed instances",
+		Long: "List the archive of killed instances, most recent first. The archive keeps the final diff, " +
+			"the prompts sent, the final scrollback and a ref to the final state of the branch of every " +
+			"killed instance.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.CloseSilently()
+
+			entries, err := session.LoadArchive()
+			if err != nil {
+				return err
+			}
+			if historySearchFlag != "" {
+				var matched []*session.ArchiveEntry
+				for _, entry := range entries {
+					if entry.Matches(historySearchFlag) {
+						matched = append(matched, entry)
+					}
+				}
+				entries = matched
+			}
+
+			if historyJSONFlag {
+				if entries == nil {
+					entries = []*session.ArchiveEntry{}
+				}
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(entries)
+			}
+
+			if len(entries) == 0 {
+				fmt.Println("No archived instances")
+				return nil
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tTITLE\tBRANCH\tPROGRAM\tPROMPTS\tDIFF\tSPENT\tKILLED")
+			for _, e := range entries {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t+%d,-%d\t%s\t%s\n", e.ID, e.Title, e.Branch, e.Program,
+					len(e.Prompts), e.Added, e.Removed, e.TimeSpent().Round(time.Second),
+					e.KilledAt.Local().Format(time.DateTime))
+			}
+			return w.Flush()
+		},
+	}
+
+	historyShowCmd = &cobra.Command{
+		Use:   "show <id|title>",
+		Short: "Print an archived instance with its prompts",
+		Long: "Print an archived instance with its prompts. A title refers to the most recently killed " +
+			"instance with that title.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.CloseSilently()
+
+			entry, err := findArchiveEntry(args[0])
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case historyDiffFlag:
+				_, err = fmt.Print(entry.Diff)
+				return err
+			case historyScrollbackFlag:
+				_, err = fmt.Print(entry.Scrollback)
+				return err
+			}
+
+			fmt.Printf("ID:       %s\n", entry.ID)
+			fmt.Printf("Title:    %s\n", entry.Title)
+			fmt.Printf("Branch:   %s\n", entry.Branch)
+			fmt.Printf("Program:  %s\n", entry.Program)
+			fmt.Printf("Repo:     %s\n", entry.RepoPath)
+			fmt.Printf("Created:  %s\n", entry.CreatedAt.Local().Format(time.DateTime))
+			fmt.Printf("Killed:   %s\n", entry.KilledAt.Local().Format(time.DateTime))
+			fmt.Printf("Spent:    %s\n", entry.TimeSpent().Round(time.Second))
+			fmt.Printf("Diff:     +%d,-%d\n", entry.Added, entry.Removed)
+			if entry.KeptRef != "" {
+				fmt.Printf("Kept ref: %s (%s)\n", entry.KeptRef, entry.KeptCommitSHA)
+			}
+			fmt.Printf("\nPrompts:\n")
+			if len(entry.Prompts) == 0 {
+				fmt.Println("  none recorded")
+			}
+			for _, prompt := range entry.Prompts {
+				text := strings.ReplaceAll(strings.TrimSpace(prompt.Text), "\n", "\n    ")
+				fmt.Printf("  %s\n    %s\n", prompt.Time.Local().Format(time.DateTime), text)
+			}
+			return nil
+		},
+	}
+
+	historyRestoreCmd = &cobra.Command{
+		Use:   "restore <id|title>",
+		Short: "Recreate the branch of an archived instance",
+		Long: "Recreate the branch of an archived instance from its kept ref, including the changes which " +
+			"were uncommitted when it was killed. Existing branches are never overwritten.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.CloseSilently()
+
+			entry, err := findArchiveEntry(args[0])
+			if err != nil {
+				return err
+			}
+			if err := entry.RestoreBranch(historyBranchFlag); err != nil {
+				return err
+			}
+			branch := historyBranchFlag
+			if branch == "" {
+				branch = entry.Branch
+			}
+			fmt.Printf("Restored branch %s in %s\n", branch, entry.RepoPath)
+			return nil
+		},
+	}
+)
+
+// findArchiveEntry returns the archived instance with the given ID, or the most recently killed one with
+// the given title.
+func findArchiveEntry(ref string) (*session.ArchiveEntry, error) {
+	entries, err := session.LoadArchive()
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.ID == ref {
+			return entry, nil
+		}
+	}
+	// Entries are sorted by the time they were killed, most recent first.
+	for _, entry := range entries {
+		if entry.Title == ref {
+			return entry, nil
+		}
+	}
+	return nil, fmt.Errorf("archived instance not found: %s", ref)
+}
+
+func init() {
+	historyCmd.Flags().StringVarP(&historySearchFlag, "search", "s", "",
+		"Only list instances whose title, branch, program, prompts, diff or scrollback contain this text")
+	historyCmd.Flags().BoolVar(&historyJSONFlag, "json", false, "Print the archived instances as JSON")
+
+	historyShowCmd.Flags().BoolVar(&historyDiffFlag, "diff", false, "Print only the final diff")
+	historyShowCmd.Flags().BoolVar(&historyScrollbackFlag, "scrollback", false, "Print only the final scrollback")
+	historyShowCmd.MarkFlagsMutuallyExclusive("diff", "scrollback")
+
+	historyRestoreCmd.Flags().StringVarP(&historyBranchFlag, "branch", "b", "",
+		"Name of the branch to create (defaults to the original branch name)")
+
+	historyCmd.AddCommand(historyShowCmd, historyRestoreCmd)
+	rootCmd.AddCommand(historyCmd)
+}
@@ -22,12 +22,22 @@ const (
 
 	KeyCheckout
 	KeyResume
-	KeyPrompt // New key for entering a prompt
-	KeyHelp   // Key for showing help screen
+	KeyPrompt      // New key for entering a prompt
+	KeyHelp        // Key for showing help screen
+	KeyRename      // Key for renaming the selected instance
+	KeyToggleRepos // Key for toggling between the instances of the current repo and all repos
+	KeyRepair      // Repair is a special keybinding for opening a lost instance, which shows its repair options.
+	KeyWindow      // Key for switching the previewed window between the program and its companions
 
-	// Diff keybindings
+	// Diff and preview scrolling keybindings
 	KeyShiftUp
 	KeyShiftDown
+	KeyPageUp
+	KeyPageDown
+	KeyTop
+	KeyBottom
+	KeyFollow     // Key for toggling whether the scrolled preview follows new output
+	KeyStopScroll // Key for leaving the scroll mode of the preview
 )
 
 // GlobalKeyStringsMap is a global, immutable map string to keybinding.
@@ -49,6 +59,15 @@ var GlobalKeyStringsMap = map[string]KeyName{
 	"r":          KeyResume,
 	"p":          KeySubmit,
 	"?":          KeyHelp,
+	"R":          KeyRename,
+	"a":          KeyToggleRepos,
+	"w":          KeyWindow,
+	"pgup":       KeyPageUp,
+	"pgdown":     KeyPageDown,
+	"home":       KeyTop,
+	"end":        KeyBottom,
+	"f":          KeyFollow,
+	"esc":        KeyStopScroll,
 }
 
 // GlobalkeyBindings is a global, immutable map of KeyName tot keybinding.
@@ -69,6 +88,30 @@ var GlobalkeyBindings = map[KeyName]key.Binding{
 		key.WithKeys("shift+down"),
 		key.WithHelp("shift+↓", "scroll"),
 	),
+	KeyPageUp: key.NewBinding(
+		key.WithKeys("pgup"),
+		key.WithHelp("pgup", "page up"),
+	),
+	KeyPageDown: key.NewBinding(
+		key.WithKeys("pgdown"),
+		key.WithHelp("pgdn", "page down"),
+	),
+	KeyTop: key.NewBinding(
+		key.WithKeys("home"),
+		key.WithHelp("home", "top"),
+	),
+	KeyBottom: key.NewBinding(
+		key.WithKeys("end"),
+		key.WithHelp("end", "bottom"),
+	),
+	KeyFollow: key.NewBinding(
+		key.WithKeys("f"),
+		key.WithHelp("f", "follow"),
+	),
+	KeyStopScroll: key.NewBinding(
+		key.WithKeys("esc"),
+		key.WithHelp("esc", "back to screen"),
+	),
 	KeyEnter: key.NewBinding(
 		key.WithKeys("enter", "o"),
 		key.WithHelp("↵/o", "open"),
@@ -109,6 +152,18 @@ var GlobalkeyBindings = map[KeyName]key.Binding{
 		key.WithKeys("r"),
 		key.WithHelp("r", "resume"),
 	),
+	KeyRename: key.NewBinding(
+		key.WithKeys("R"),
+		key.WithHelp("R", "rename"),
+	),
+	KeyToggleRepos: key.NewBinding(
+		key.WithKeys("a"),
+		key.WithHelp("a", "all repos"),
+	),
+	KeyWindow: key.NewBinding(
+		key.WithKeys("w"),
+		key.WithHelp("w", "window"),
+	),
 
 	// -- Special keybindings --
 
@@ -116,4 +171,8 @@ var GlobalkeyBindings = map[KeyName]key.Binding{
 		key.WithKeys("enter"),
 		key.WithHelp("enter", "submit name"),
 	),
+	KeyRepair: key.NewBinding(
+		key.WithKeys("enter", "o"),
+		key.WithHelp("↵/o", "repair"),
+	),
 }
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"claude-squad/daemon"
+	"claude-squad/log"
+	"claude-squad/session"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// errNothingToDo is returned by a lifecycleAction if the instance is already in the requested state.
+var errNothingToDo = errors.New("nothing to do")
+
+// lifecycleAction performs an operation on a detached instance and records the result in storage.
+type lifecycleAction func(storage *session.Storage, instance *session.Instance) error
+
+// newLifecycleCmd creates a command which applies action to the selected instances. It keeps going if
+// the action fails for one of them and reports the failures at the end.
+func newLifecycleCmd(use, short, done string, action lifecycleAction) *cobra.Command {
+	var all bool
+	var filter string
+
+	cmd := &cobra.Command{
+		Use:   use + " [title|index...]",
+		Short: short,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.CloseSilently()
+
+			storage, err := loadStorage()
+			if err != nil {
+				return err
+			}
+			instancesData, err := storage.LoadInstanceData()
+			if err != nil {
+				return err
+			}
+			selected, err := selectInstanceData(instancesData, args, all, filter)
+			if err != nil {
+				return err
+			}
+
+			failed := 0
+			for _, data := range selected {
+				err := action(storage, session.FromInstanceDataDetached(data))
+				if errors.Is(err, errNothingToDo) {
+					fmt.Printf("Skipped %s (%v)\n", data.Title, err)
+					continue
+				}
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %v\n", data.Title, err)
+					failed++
+					continue
+				}
+				fmt.Printf("%s %s\n", done, data.Title)
+			}
+
+			// The daemon keeps its own copy of the instances, so let it reload them.
+			if failed < len(selected) {
+				if err := daemon.RestartDaemon(); err != nil {
+					log.ErrorLog.Printf("failed to restart daemon: %v", err)
+				}
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("failed to %s %d of %d instances", use, failed, len(selected))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&all, "all", "a", false, "Select all instances")
+	cmd.Flags().StringVarP(&filter, "filter", "f", "", "Select instances whose title matches a glob pattern")
+	return cmd
+}
+
+func pauseInstance(storage *session.Storage, instance *session.Instance) error {
+	if instance.Paused() {
+		return fmt.Errorf("%w: instance is already paused", errNothingToDo)
+	}
+	if err := instance.Pause(); err != nil {
+		return err
+	}
+	return storage.UpdateInstance(instance)
+}
+
+func resumeInstance(storage *session.Storage, instance *session.Instance) error {
+	if !instance.Paused() {
+		return fmt.Errorf("%w: instance is not paused", errNothingToDo)
+	}
+	if err := instance.Resume(); err != nil {
+		return err
+	}
+	return storage.UpdateInstance(instance)
+}
+
+func killInstance(storage *session.Storage, instance *session.Instance) error {
+	return storage.KillInstance(instance)
+}
+
+func init() {
+	rootCmd.AddCommand(newLifecycleCmd("pause", "Commit changes and pause instances, keeping their branches",
+		"Paused", pauseInstance))
+	rootCmd.AddCommand(newLifecycleCmd("resume", "Resume paused instances", "Resumed", resumeInstance))
+	rootCmd.AddCommand(newLifecycleCmd("kill", "Kill instances and delete their worktrees and branches",
+		"Killed", killInstance))
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"claude-squad/api"
+	"claude-squad/log"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// instanceListing is the JSON representation of an instance printed by `cs list --json`.
+type instanceListing struct {
+	Index int `json:"index"`
+	api.InstanceInfo
+}
+
+var (
+	listJSONFlag bool
+
+	listCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List stored instances without restoring their sessions",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.CloseSilently()
+
+			storage, err := loadStorage()
+			if err != nil {
+				return err
+			}
+			instancesData, err := storage.LoadInstanceData()
+			if err != nil {
+				return err
+			}
+
+			listings := make([]instanceListing, 0, len(instancesData))
+			for i, data := range instancesData {
+				listings = append(listings, instanceListing{Index: i + 1, InstanceInfo: api.NewInstanceInfo(data)})
+			}
+
+			if listJSONFlag {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(listings)
+			}
+
+			if len(listings) == 0 {
+				fmt.Println("No instances")
+				return nil
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "#\tID\tTITLE\tBRANCH\tSTATUS\tPROGRAM\tDIFF\tUPDATED")
+			for _, l := range listings {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t+%d,-%d\t%s\n", l.Index, l.ID, l.Title, l.Branch, l.Status,
+					l.Program, l.Added, l.Removed, l.UpdatedAt.Local().Format(time.DateTime))
+			}
+			return w.Flush()
+		},
+	}
+)
+
+func init() {
+	listCmd.Flags().BoolVar(&listJSONFlag, "json", false, "Print instances as JSON")
+
+	rootCmd.AddCommand(listCmd)
+}
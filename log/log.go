@@ -48,6 +48,12 @@ func Close() {
 	fmt.Println("wrote logs to " + logFileName)
 }
 
+// CloseSilently closes the log file without printing where the logs were written. Use it in
+// commands whose output is meant to be consumed by other programs.
+func CloseSilently() {
+	_ = globalLogFile.Close()
+}
+
 // Every is used to log at most once every timeout duration.
 type Every struct {
 	timeout time.Duration
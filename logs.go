@@ -0,0 +1,98 @@
+package main
+
+import (
+	"claude-squad/log"
+	"claude-squad/session"
+	"claude-squad/session/tmux"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// logsPollInterval is how often --follow captures the pane to look for new lines.
+const logsPollInterval = 500 * time.Millisecond
+
+var (
+	logsANSIFlag   bool
+	logsFollowFlag bool
+
+	logsCmd = &cobra.Command{
+		Use:   "logs <title|index>",
+		Short: "Print the full scrollback of an instance's pane",
+		Long: "Print the full scrollback of an instance's pane. With --follow, new lines are streamed as " +
+			"they are printed. The line of the cursor is held back until the cursor leaves it, since it " +
+			"may still change.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.CloseSilently()
+
+			storage, err := loadStorage()
+			if err != nil {
+				return err
+			}
+			instancesData, err := storage.LoadInstanceData()
+			if err != nil {
+				return err
+			}
+			data, err := findInstanceData(instancesData, args[0])
+			if err != nil {
+				return err
+			}
+			if data.Status == session.Paused {
+				return fmt.Errorf("instance %s is paused and has no session to read from", data.Title)
+			}
+			instance := session.FromInstanceDataDetached(data)
+
+			if !logsFollowFlag {
+				content, err := instance.Scrollback("-", "-", logsANSIFlag)
+				if err != nil {
+					return err
+				}
+				printLines(splitPaneLines(content))
+				return nil
+			}
+
+			var follower tmux.PaneFollower
+			ticker := time.NewTicker(logsPollInterval)
+			defer ticker.Stop()
+			for ; ; <-ticker.C {
+				// Get the position first, so lines which scroll before the capture are only printed later.
+				history, cursorY, err := instance.HistoryAndCursor()
+				if err != nil {
+					return err
+				}
+				content, err := instance.Scrollback("-", "-", logsANSIFlag)
+				if err != nil {
+					return err
+				}
+				printLines(follower.Next(splitPaneLines(content), history, cursorY))
+			}
+		},
+	}
+)
+
+// splitPaneLines splits captured pane content into lines, dropping the empty rows at the bottom of
+// the screen.
+func splitPaneLines(content string) []string {
+	content = strings.TrimRight(content, "\n")
+	if content == "" {
+		return nil
+	}
+	return strings.Split(content, "\n")
+}
+
+func printLines(lines []string) {
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+}
+
+func init() {
+	logsCmd.Flags().BoolVar(&logsANSIFlag, "ansi", false, "Keep ANSI escape sequences such as colors")
+	logsCmd.Flags().BoolVarP(&logsFollowFlag, "follow", "f", false, "Keep streaming new output")
+
+	rootCmd.AddCommand(logsCmd)
+}
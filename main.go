@@ -12,17 +12,20 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
 
 var (
-	version     = "1.0.0"
-	programFlag string
-	autoYesFlag bool
-	daemonFlag  bool
-	rootCmd     = &cobra.Command{
+	version      = "1.0.0"
+	programFlag  string
+	autoYesFlag  bool
+	allReposFlag bool
+	daemonFlag   bool
+	rootCmd      = &cobra.Command{
 		Use:   "claude-squad",
 		Short: "Claude Squad - A terminal-based session manager",
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -71,7 +74,7 @@ var (
 				log.ErrorLog.Printf("failed to stop daemon: %v", err)
 			}
 
-			return app.Run(ctx, program, autoYes)
+			return app.Run(ctx, program, autoYes, allReposFlag)
 		},
 	}
 
@@ -82,17 +85,33 @@ var (
 			log.Initialize(false)
 			defer log.Close()
 
-			state := config.LoadState()
-			storage, err := session.NewStorage(state)
+			state, err := config.LoadState()
 			if err != nil {
-				return fmt.Errorf("failed to initialize storage: %w", err)
+				// Resetting is the way out of an unreadable state file, which LoadState has backed up.
+				fmt.Printf("Discarding unreadable state: %v\n", err)
+				if state, err = config.ResetState(); err != nil {
+					return fmt.Errorf("failed to reset state: %w", err)
+				}
+			}
+			storage, err := session.OpenStorage(config.LoadConfig(), state)
+			if err != nil {
+				return err
+			}
+			// The sessions of the stored instances are cleaned up on the default tmux server too.
+			instancesData, err := storage.LoadInstanceData()
+			if err != nil {
+				fmt.Printf("Not cleaning up sessions on the default tmux server, instances can't be read: %v\n", err)
+			}
+			ids := make([]string, 0, len(instancesData))
+			for _, data := range instancesData {
+				ids = append(ids, data.ID)
 			}
 			if err := storage.DeleteAllInstances(); err != nil {
 				return fmt.Errorf("failed to reset storage: %w", err)
 			}
 			fmt.Println("Storage has been reset successfully")
 
-			if err := tmux.CleanupSessions(cmd2.MakeExecutor()); err != nil {
+			if err := tmux.CleanupSessions(cmd2.MakeExecutor(), ids); err != nil {
 				return fmt.Errorf("failed to cleanup tmux sessions: %w", err)
 			}
 			fmt.Println("Tmux sessions have been cleaned up")
@@ -116,6 +135,10 @@ var (
 		Use:   "debug",
 		Short: "Print debug information like config paths",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			// LoadConfig logs the problems of an invalid config.
+			log.Initialize(false)
+			defer log.CloseSilently()
+
 			cfg := config.LoadConfig()
 
 			configDir, err := config.GetConfigDir()
@@ -124,7 +147,12 @@ var (
 			}
 			configJson, _ := json.MarshalIndent(cfg, "", "  ")
 
-			fmt.Printf("Config: %s\n%s\n", filepath.Join(configDir, config.ConfigFileName), configJson)
+			fmt.Printf("Config: %s\n", filepath.Join(configDir, config.ConfigFileName))
+			if projectConfig, ok := config.FindProjectConfig("."); ok {
+				fmt.Printf("Project config: %s\n", projectConfig)
+			}
+			fmt.Printf("%s\n", configJson)
+			fmt.Printf("Tmux server: tmux %s\n", strings.Join(tmux.ServerArgs(), " "))
 
 			return nil
 		},
@@ -141,10 +169,27 @@ var (
 )
 
 func init() {
+	// The TUI refuses to run with a config which would be partially ignored, the other commands only warn. The
+	// daemon runs in the background, where nobody would see the error, so it opts out like reset, debug and
+	// the config commands, which have to work with an invalid config.
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if daemonFlag {
+			return nil
+		}
+		return checkConfig(cmd, cmd == rootCmd)
+	}
+	for _, cmd := range []*cobra.Command{resetCmd, debugCmd, versionCmd} {
+		cmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+			return nil
+		}
+	}
+
 	rootCmd.Flags().StringVarP(&programFlag, "program", "p", "",
 		"Program to run in new instances (e.g. 'aider --model ollama_chat/gemma3:1b')")
 	rootCmd.Flags().BoolVarP(&autoYesFlag, "autoyes", "y", false,
 		"[experimental] If enabled, all instances will automatically accept prompts")
+	rootCmd.Flags().BoolVar(&allReposFlag, "all-repos", false,
+		"List the instances of all repositories instead of only the current one (toggle with 'a')")
 	rootCmd.Flags().BoolVar(&daemonFlag, "daemon", false, "Run a program that loads all sessions"+
 		" and runs autoyes mode on them.")
 
@@ -159,8 +204,24 @@ func init() {
 	rootCmd.AddCommand(resetCmd)
 }
 
+// checkConfig reports the problems of the config. If strict is set, they are an error, otherwise a warning.
+func checkConfig(cmd *cobra.Command, strict bool) error {
+	err := config.CheckConfig()
+	if err == nil {
+		return nil
+	}
+	if strict {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("invalid config, fix it with `cs config edit` or `cs config set`:\n%w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Warning: invalid config, fix it with `cs config edit` or `cs config set`:\n%v\n", err)
+	return nil
+}
+
 func main() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
+		// Scripts chaining commands need a non-zero exit code to detect failures.
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"claude-squad/config"
+	"claude-squad/daemon"
+	"claude-squad/log"
+	"claude-squad/session"
+	"claude-squad/session/git"
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	newTitleFlag   string
+	newProgramFlag string
+	newPromptFlag  string
+	newPathFlag    string
+	newAutoYesFlag bool
+	newBaseFlag    string
+
+	newCmd = &cobra.Command{
+		Use:   "new",
+		Short: "Create a new instance without opening the TUI",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.CloseSilently()
+
+			path, err := filepath.Abs(newPathFlag)
+			if err != nil {
+				return fmt.Errorf("failed to get absolute path: %w", err)
+			}
+			if !git.IsGitRepo(path) {
+				return fmt.Errorf("error: %s is not within a git repository", path)
+			}
+
+			cfg := config.LoadConfigFor(path)
+			program := cfg.DefaultProgram
+			if newProgramFlag != "" {
+				program = newProgramFlag
+			}
+			autoYes := cfg.AutoYes || newAutoYesFlag
+
+			storage, err := loadStorage()
+			if err != nil {
+				return err
+			}
+			instance, err := storage.CreateInstance(session.InstanceOptions{
+				Title:   newTitleFlag,
+				Path:    path,
+				Program: program,
+				AutoYes: autoYes,
+				BaseRef: newBaseFlag,
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Created instance %s on branch %s\n", instance.Title, instance.Branch)
+
+			if autoYes {
+				if err := daemon.RestartDaemon(); err != nil {
+					log.ErrorLog.Printf("failed to restart daemon: %v", err)
+				}
+			}
+
+			if newPromptFlag == "" {
+				return nil
+			}
+			if err := instance.WaitUntilReady(defaultReadyTimeout); err != nil {
+				return err
+			}
+			if err := storage.SendPrompt(instance, newPromptFlag); err != nil {
+				return fmt.Errorf("failed to send prompt: %w", err)
+			}
+			fmt.Println("Sent prompt")
+			return nil
+		},
+	}
+)
+
+func init() {
+	newCmd.Flags().StringVarP(&newTitleFlag, "title", "t", "", "Title of the new instance")
+	newCmd.Flags().StringVarP(&newProgramFlag, "program", "p", "",
+		"Program to run in the instance (defaults to the configured default program)")
+	newCmd.Flags().StringVar(&newPromptFlag, "prompt", "", "Prompt to send once the program is ready")
+	newCmd.Flags().StringVar(&newPathFlag, "path", ".", "Path within the git repository to create the instance for")
+	newCmd.Flags().StringVar(&newBaseFlag, "base", "", "Branch, tag or commit to start from (defaults to HEAD)")
+	newCmd.Flags().BoolVarP(&newAutoYesFlag, "autoyes", "y", false,
+		"[experimental] Automatically accept prompts in the new instance")
+	if err := newCmd.MarkFlagRequired("title"); err != nil {
+		panic(err)
+	}
+
+	// New instances are started with the config, so it has to be valid.
+	newCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		return checkConfig(cmd, true)
+	}
+
+	rootCmd.AddCommand(newCmd)
+}
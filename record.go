@@ -0,0 +1,102 @@
+package main
+
+import (
+	"claude-squad/session/asciicast"
+	"claude-squad/session/tmux"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// recordResizeInterval is how often the recorder checks whether the pane was resized.
+const recordResizeInterval = time.Second
+
+var (
+	recordWidthFlag  int
+	recordHeightFlag int
+	recordSocketFlag string
+	recordPaneFlag   string
+
+	// recordCmd is run by tmux for each recorded session, which pipes what the program prints into it.
+	recordCmd = &cobra.Command{
+		Use:    tmux.RecordCommand + " <path>",
+		Short:  "Append what is read from stdin to an asciicast recording",
+		Hidden: true,
+		Args:   cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			recorder, f, err := asciicast.AppendFile(args[0], asciicast.Header{
+				Width:  recordWidthFlag,
+				Height: recordHeightFlag,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to open recording: %w", err)
+			}
+			defer f.Close()
+
+			// Reads return what the program printed at once, which keeps the timing of the events.
+			chunks := make(chan []byte)
+			var readErr error
+			go func() {
+				defer close(chunks)
+				buf := make([]byte, 32*1024)
+				for {
+					n, err := os.Stdin.Read(buf)
+					if n > 0 {
+						chunks <- append([]byte(nil), buf[:n]...)
+					}
+					if err != nil {
+						if err != io.EOF {
+							readErr = err
+						}
+						return
+					}
+				}
+			}()
+
+			var resizeCheck <-chan time.Time
+			if recordPaneFlag != "" {
+				ticker := time.NewTicker(recordResizeInterval)
+				defer ticker.Stop()
+				resizeCheck = ticker.C
+			}
+			width, height := recordWidthFlag, recordHeightFlag
+			for {
+				select {
+				case data, ok := <-chunks:
+					if !ok {
+						return readErr
+					}
+					if _, err := recorder.Write(data); err != nil {
+						return err
+					}
+				case <-resizeCheck:
+					w, h, err := tmux.PaneSize(recordSocketFlag, recordPaneFlag)
+					if err != nil || (w == width && h == height) {
+						// The pane is gone when the session ends, the rest of the output is still recorded.
+						continue
+					}
+					width, height = w, h
+					if err := recorder.Resize(time.Now(), width, height); err != nil {
+						return err
+					}
+				}
+			}
+		},
+	}
+)
+
+func init() {
+	recordCmd.Flags().IntVar(&recordWidthFlag, "width", 80, "Width of the terminal being recorded")
+	recordCmd.Flags().IntVar(&recordHeightFlag, "height", 24, "Height of the terminal being recorded")
+	recordCmd.Flags().StringVar(&recordSocketFlag, "socket", "", "Socket of the tmux server the pane is on")
+	recordCmd.Flags().StringVar(&recordPaneFlag, "pane", "", "ID of the pane whose resizes are recorded")
+	// The recorder runs as long as the session, a config changed in the meantime must not stop it.
+	recordCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		return nil
+	}
+
+	rootCmd.AddCommand(recordCmd)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"claude-squad/daemon"
+	"claude-squad/log"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var renameCmd = &cobra.Command{
+	Use:   "rename <title|index> <new-title>",
+	Short: "Change the title of an instance",
+	Long: "Change the title of an instance. Titles are only labels: the tmux session, worktree and branch " +
+		"of the instance keep their names.",
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log.Initialize(false)
+		defer log.CloseSilently()
+
+		storage, err := loadStorage()
+		if err != nil {
+			return err
+		}
+		instancesData, err := storage.LoadInstanceData()
+		if err != nil {
+			return err
+		}
+		data, err := findInstanceData(instancesData, args[0])
+		if err != nil {
+			return err
+		}
+		if err := storage.RenameInstance(data.ID, args[1]); err != nil {
+			return err
+		}
+
+		// The daemon keeps its own copy of the instances, so let it reload them.
+		if err := daemon.RestartDaemon(); err != nil {
+			log.ErrorLog.Printf("failed to restart daemon: %v", err)
+		}
+
+		fmt.Printf("Renamed %s to %s\n", data.Title, args[1])
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(renameCmd)
+}
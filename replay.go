@@ -0,0 +1,153 @@
+package main
+
+import (
+	"claude-squad/log"
+	"claude-squad/session/asciicast"
+	"claude-squad/session/tmux"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// replaySeekStep is how far the arrow keys seek.
+const replaySeekStep = 5 * time.Second
+
+var (
+	replaySpeedFlag     float64
+	replayFromFlag      time.Duration
+	replayIdleLimitFlag time.Duration
+
+	replayCmd = &cobra.Command{
+		Use:   "replay <title|index|id>",
+		Short: "Play back the recording of an instance's session",
+		Long: "Play back the recording of an instance's session, which is made with record_sessions enabled. " +
+			"Killed instances are looked up in the archive.\n\n" +
+			"While playing, space pauses, ←/→ seek 5 seconds, +/- double or halve the speed and q quits.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.CloseSilently()
+
+			if replaySpeedFlag <= 0 {
+				return fmt.Errorf("--speed must be positive, got %v", replaySpeedFlag)
+			}
+			path, title, err := findRecording(args[0])
+			if err != nil {
+				return err
+			}
+			header, events, err := asciicast.ReadFile(path)
+			if errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("instance %s has no recording, set record_sessions to record new sessions", title)
+			}
+			if err != nil {
+				return err
+			}
+			player := asciicast.NewPlayer(os.Stdout, header, events, replaySpeedFlag, replayIdleLimitFlag)
+
+			stdinFd := int(os.Stdin.Fd())
+			if !term.IsTerminal(stdinFd) || !term.IsTerminal(int(os.Stdout.Fd())) {
+				// Without a terminal to take keys from, the recording is played once.
+				if err := player.Seek(replayFromFlag); err != nil {
+					return err
+				}
+				return player.Play(context.Background(), nil)
+			}
+
+			oldState, err := term.MakeRaw(stdinFd)
+			if err != nil {
+				return fmt.Errorf("failed to put terminal into raw mode: %w", err)
+			}
+			defer func() {
+				_ = term.Restore(stdinFd, oldState)
+			}()
+
+			// Use the alternate screen so the shell is left as it was after replaying.
+			fmt.Print("\x1b[?1049h\x1b[H\x1b[2J")
+			defer fmt.Print("\x1b[?1049l")
+
+			if err := player.Seek(replayFromFlag); err != nil {
+				return err
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			err = player.Play(ctx, readReplayControls(cancel))
+			if errors.Is(err, context.Canceled) {
+				return nil
+			}
+			return err
+		},
+	}
+)
+
+// findRecording returns the path of the recording of an instance and its title. Instances which don't exist
+// anymore are looked up in the archive.
+func findRecording(ref string) (path string, title string, err error) {
+	var id string
+	storage, err := loadStorage()
+	if err != nil {
+		return "", "", err
+	}
+	instancesData, err := storage.LoadInstanceData()
+	if err != nil {
+		return "", "", err
+	}
+	if data, err := findInstanceData(instancesData, ref); err == nil {
+		id, title = data.ID, data.Title
+	} else if entry, archiveErr := findArchiveEntry(ref); archiveErr == nil {
+		id, title = entry.ID, entry.Title
+	} else {
+		return "", "", fmt.Errorf("%w, and no archived instance either", err)
+	}
+	path, err = tmux.RecordingPath(id)
+	return path, title, err
+}
+
+// readReplayControls turns the keys pressed while replaying into controls of the player. q and ctrl-c call
+// quit.
+func readReplayControls(quit func()) <-chan asciicast.Control {
+	controls := make(chan asciicast.Control)
+	go func() {
+		buf := make([]byte, 32)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				quit()
+				return
+			}
+			var control asciicast.Control
+			switch string(buf[:n]) {
+			case "q", "\x03":
+				quit()
+				return
+			case " ":
+				control.TogglePause = true
+			case "\x1b[C", "l":
+				control.Seek = replaySeekStep
+			case "\x1b[D", "h":
+				control.Seek = -replaySeekStep
+			case "+", "=":
+				control.Speed = 2
+			case "-":
+				control.Speed = 0.5
+			default:
+				continue
+			}
+			controls <- control
+		}
+	}()
+	return controls
+}
+
+func init() {
+	replayCmd.Flags().Float64VarP(&replaySpeedFlag, "speed", "s", 1, "Playback speed, e.g. 2 for twice as fast")
+	replayCmd.Flags().DurationVar(&replayFromFlag, "from", 0, "Start playing at this time of the recording, e.g. 1m30s")
+	replayCmd.Flags().DurationVar(&replayIdleLimitFlag, "idle-limit", 2*time.Second,
+		"Shorten pauses longer than this, 0 keeps them")
+
+	rootCmd.AddCommand(replayCmd)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"claude-squad/log"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	sendFileFlag      string
+	sendWaitReadyFlag bool
+	sendTimeoutFlag   time.Duration
+
+	sendCmd = &cobra.Command{
+		Use:   "send <title|index> [prompt]",
+		Short: "Send a prompt to a running instance",
+		Long: "Send a prompt to a running instance. The prompt is read from the second argument, from the " +
+			"file given by --file, or from stdin.",
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			log.Initialize(false)
+			defer log.CloseSilently()
+
+			prompt, err := readPrompt(args[1:])
+			if err != nil {
+				return err
+			}
+			if strings.TrimSpace(prompt) == "" {
+				return fmt.Errorf("prompt cannot be empty")
+			}
+
+			storage, err := loadStorage()
+			if err != nil {
+				return err
+			}
+			instance, err := loadInstance(storage, args[0])
+			if err != nil {
+				return err
+			}
+			if instance.Paused() {
+				return fmt.Errorf("instance %s is paused, resume it first", instance.Title)
+			}
+
+			if err := storage.SendPrompt(instance, prompt); err != nil {
+				return fmt.Errorf("failed to send prompt: %w", err)
+			}
+			if !sendWaitReadyFlag {
+				return nil
+			}
+			return instance.WaitUntilReady(sendTimeoutFlag)
+		},
+	}
+)
+
+// readPrompt returns the prompt from the positional argument, the --file flag or stdin, in that order.
+func readPrompt(args []string) (string, error) {
+	if len(args) > 0 && sendFileFlag != "" {
+		return "", fmt.Errorf("cannot use both a prompt argument and --file")
+	}
+	if len(args) > 0 {
+		return args[0], nil
+	}
+
+	var data []byte
+	var err error
+	if sendFileFlag != "" {
+		data, err = os.ReadFile(sendFileFlag)
+	} else {
+		data, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read prompt: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func init() {
+	sendCmd.Flags().StringVarP(&sendFileFlag, "file", "f", "", "Read the prompt from a file")
+	sendCmd.Flags().BoolVarP(&sendWaitReadyFlag, "wait-ready", "w", false,
+		"Block until the instance is ready for input again")
+	sendCmd.Flags().DurationVar(&sendTimeoutFlag, "timeout", defaultReadyTimeout,
+		"How long --wait-ready waits before giving up")
+
+	rootCmd.AddCommand(sendCmd)
+}
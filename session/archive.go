@@ -0,0 +1,207 @@
+package session
+
+import (
+	"claude-squad/config"
+	"claude-squad/log"
+	"claude-squad/session/git"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ArchiveDirName is the directory in the config directory which holds the archive of killed instances.
+const ArchiveDirName = "archive"
+
+// archiveRefPrefix is where the work of killed instances is kept in their repository, since their branch
+// is deleted.
+const archiveRefPrefix = "refs/claudesquad/archive/"
+
+// PromptRecord is a prompt which was sent to an instance.
+type PromptRecord struct {
+	Time time.Time `json:"time"`
+	Text string    `json:"text"`
+}
+
+// ArchiveEntry records what a killed instance did.
+type ArchiveEntry struct {
+	ID            string `json:"id"`
+	Title         string `json:"title"`
+	Branch        string `json:"branch"`
+	Program       string `json:"program"`
+	RepoPath      string `json:"repo_path"`
+	BaseCommitSHA string `json:"base_commit_sha"`
+	// KeptRef points at the final state of the branch, including uncommitted changes. It is empty if the
+	// branch couldn't be kept.
+	KeptRef       string `json:"kept_ref,omitempty"`
+	KeptCommitSHA string `json:"kept_commit_sha,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	KilledAt  time.Time `json:"killed_at"`
+
+	Prompts []PromptRecord `json:"prompts"`
+	// Diff is the final patch against the base commit.
+	Diff    string `json:"diff"`
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+	// Scrollback is the final content of the pane including its history. It is empty if the instance was
+	// paused or lost.
+	Scrollback string `json:"scrollback"`
+}
+
+// TimeSpent returns how long the instance existed.
+func (e *ArchiveEntry) TimeSpent() time.Duration {
+	return e.KilledAt.Sub(e.CreatedAt)
+}
+
+// Matches returns true if query occurs in the title, branch, program, prompts, diff or scrollback of the
+// entry, ignoring case.
+func (e *ArchiveEntry) Matches(query string) bool {
+	query = strings.ToLower(query)
+	fields := []string{e.ID, e.Title, e.Branch, e.Program, e.Diff, e.Scrollback}
+	for _, prompt := range e.Prompts {
+		fields = append(fields, prompt.Text)
+	}
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// RestoreBranch creates a branch from the kept ref of the entry. If branch is empty, the original branch
+// name is used.
+func (e *ArchiveEntry) RestoreBranch(branch string) error {
+	if e.KeptRef == "" {
+		return fmt.Errorf("no ref was kept for instance %s", e.Title)
+	}
+	if branch == "" {
+		branch = e.Branch
+	}
+	return git.RestoreBranch(e.RepoPath, branch, e.KeptRef)
+}
+
+// newArchiveEntry collects what an instance did right before it is killed. Everything is collected on a
+// best effort basis, so an instance with a broken worktree or session can still be archived and killed.
+// stored is the record of the instance in storage, which holds its prompts.
+func newArchiveEntry(instance *Instance, stored InstanceData) *ArchiveEntry {
+	worktree := instance.gitWorktree
+	entry := &ArchiveEntry{
+		ID:            instance.ID,
+		Title:         instance.Title,
+		Branch:        instance.Branch,
+		Program:       instance.Program,
+		RepoPath:      worktree.GetRepoPath(),
+		BaseCommitSHA: worktree.GetBaseCommitSHA(),
+		CreatedAt:     instance.CreatedAt,
+		KilledAt:      time.Now(),
+		Prompts:       stored.Prompts,
+		// Replaced below if the session is still around.
+		Scrollback: stored.ImportedScrollback,
+	}
+	if entry.Prompts == nil {
+		entry.Prompts = []PromptRecord{}
+	}
+
+	ref := archiveRefPrefix + instance.ID
+	message := fmt.Sprintf("[claudesquad] uncommitted changes of '%s' when it was killed on %s", instance.Title,
+		entry.KilledAt.Format(time.RFC822))
+	if commit, err := worktree.KeepRef(ref, message); err != nil {
+		log.WarningLog.Printf("could not keep the branch of instance %s: %v", instance.Title, err)
+	} else {
+		entry.KeptRef = ref
+		entry.KeptCommitSHA = commit
+	}
+
+	if entry.KeptRef != "" && entry.BaseCommitSHA != "" {
+		if diff, err := worktree.DiffCommit(entry.KeptCommitSHA); err != nil {
+			log.WarningLog.Printf("could not diff instance %s: %v", instance.Title, err)
+		} else {
+			entry.Diff = diff
+		}
+	} else if stats := instance.GetDiffStats(); stats != nil {
+		// Fall back to the last diff we know of.
+		entry.Diff = stats.Content
+	}
+	entry.Added, entry.Removed = git.CountChanges(entry.Diff)
+
+	if !instance.Paused() && !instance.Lost() && instance.tmuxSession != nil &&
+		instance.tmuxSession.DoesSessionExist() {
+		if scrollback, err := instance.Scrollback("-", "-", false); err != nil {
+			log.WarningLog.Printf("could not capture scrollback of instance %s: %v", instance.Title, err)
+		} else {
+			entry.Scrollback = scrollback
+		}
+	}
+	return entry
+}
+
+func getArchiveDir() (string, error) {
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get config directory: %w", err)
+	}
+	return filepath.Join(configDir, ArchiveDirName), nil
+}
+
+// SaveArchiveEntry stores an entry in the archive, replacing any entry with the same ID.
+func SaveArchiveEntry(entry *ArchiveEntry) error {
+	dir, err := getArchiveDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal archive entry: %w", err)
+	}
+	path := filepath.Join(dir, entry.ID+".json")
+	if err := config.WriteFileAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write archive entry: %w", err)
+	}
+	return nil
+}
+
+// LoadArchive returns the archived instances, most recently killed first. Unreadable entries are
+// skipped with a warning.
+func LoadArchive() ([]*ArchiveEntry, error) {
+	dir, err := getArchiveDir()
+	if err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	var entries []*ArchiveEntry
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			log.WarningLog.Printf("failed to read archive entry %s: %v", file.Name(), err)
+			continue
+		}
+		var entry ArchiveEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			log.WarningLog.Printf("failed to parse archive entry %s: %v", file.Name(), err)
+			continue
+		}
+		entries = append(entries, &entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].KilledAt.After(entries[j].KilledAt)
+	})
+	return entries, nil
+}
@@ -0,0 +1,37 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchive(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	entries, err := LoadArchive()
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	killed := time.Now()
+	older := &ArchiveEntry{ID: "1", Title: "older", KilledAt: killed.Add(-time.Hour), Prompts: []PromptRecord{
+		{Time: killed.Add(-2 * time.Hour), Text: "Fix the Login redirect"},
+	}}
+	newer := &ArchiveEntry{ID: "2", Title: "newer", CreatedAt: killed.Add(-time.Minute), KilledAt: killed,
+		Diff: "+func main() {}"}
+	require.NoError(t, SaveArchiveEntry(older))
+	require.NoError(t, SaveArchiveEntry(newer))
+
+	entries, err = LoadArchive()
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "newer", entries[0].Title)
+	assert.Equal(t, "older", entries[1].Title)
+	assert.Equal(t, time.Minute, entries[0].TimeSpent())
+
+	assert.True(t, entries[1].Matches("login"))
+	assert.True(t, entries[0].Matches("func main"))
+	assert.False(t, entries[0].Matches("login"))
+}
@@ -0,0 +1,218 @@
+// Package asciicast reads and writes terminal recordings in the asciicast v2 format of asciinema, see
+// https://docs.asciinema.org/manual/asciicast/v2/.
+package asciicast
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+	"unicode/utf8"
+)
+
+// Version is the version of the format written in the header.
+const Version = 2
+
+// EventOutput is the type of events holding what the terminal printed.
+const EventOutput = "o"
+
+// EventResize is the type of events holding the new size of the terminal, e.g. "100x30".
+const EventResize = "r"
+
+// Header is the first line of a recording.
+type Header struct {
+	Version int `json:"version"`
+	Width   int `json:"width"`
+	Height  int `json:"height"`
+	// Timestamp is when the recording started, in seconds since the unix epoch. The times of the events are
+	// relative to it.
+	Timestamp int64  `json:"timestamp,omitempty"`
+	Title     string `json:"title,omitempty"`
+}
+
+// Event is a line of a recording after the header, e.g. [1.25, "o", "hello"].
+type Event struct {
+	// Time is the time of the event in seconds since the start of the recording.
+	Time float64
+	Type string
+	Data string
+}
+
+func (e Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]any{e.Time, e.Type, e.Data})
+}
+
+func (e *Event) UnmarshalJSON(data []byte) error {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if len(fields) != 3 {
+		return fmt.Errorf("expected an event of 3 fields, got %d", len(fields))
+	}
+	if err := json.Unmarshal(fields[0], &e.Time); err != nil {
+		return fmt.Errorf("invalid event time: %w", err)
+	}
+	if err := json.Unmarshal(fields[1], &e.Type); err != nil {
+		return fmt.Errorf("invalid event type: %w", err)
+	}
+	if err := json.Unmarshal(fields[2], &e.Data); err != nil {
+		return fmt.Errorf("invalid event data: %w", err)
+	}
+	return nil
+}
+
+// Read reads a recording. Events of other types than output and resize are kept, players skip them.
+func Read(r io.Reader) (Header, []Event, error) {
+	scanner := bufio.NewScanner(r)
+	// A single event holds what was printed at once, which can be a whole screen.
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	var header Header
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return Header{}, nil, err
+		}
+		return Header{}, nil, errors.New("empty recording")
+	}
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return Header{}, nil, fmt.Errorf("invalid header: %w", err)
+	}
+	if header.Version != Version {
+		return Header{}, nil, fmt.Errorf("unsupported asciicast version %d", header.Version)
+	}
+
+	var events []Event
+	for line := 2; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return Header{}, nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return Header{}, nil, err
+	}
+	return header, events, nil
+}
+
+// ReadFile reads the recording at path.
+func ReadFile(path string) (Header, []Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Header{}, nil, err
+	}
+	defer f.Close()
+	header, events, err := Read(f)
+	if err != nil {
+		return Header{}, nil, fmt.Errorf("failed to read recording %s: %w", path, err)
+	}
+	return header, events, nil
+}
+
+// Recorder appends the output of a terminal to a recording as output events.
+type Recorder struct {
+	w     io.Writer
+	start time.Time
+	// partial is the start of a UTF-8 sequence which was cut off at the end of the last write. JSON strings
+	// can't hold it, so it is written with the rest of the sequence.
+	partial []byte
+}
+
+// NewRecorder returns a recorder which writes a new recording to w, starting with its header.
+func NewRecorder(w io.Writer, header Header, start time.Time) (*Recorder, error) {
+	header.Version = Version
+	header.Timestamp = start.Unix()
+	data, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		return nil, fmt.Errorf("failed to write header: %w", err)
+	}
+	return &Recorder{w: w, start: start}, nil
+}
+
+// AppendFile returns a recorder which appends to the recording at path. A new recording is started if the
+// file doesn't exist yet. Otherwise the times continue from the start of the existing recording, so time in
+// which nothing was recorded plays back as a pause, and the size of header is recorded as a resize, since the
+// terminal may have changed in the meantime. The returned file has to be closed by the caller.
+func AppendFile(path string, header Header) (*Recorder, *os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	existing, err := bufio.NewReader(f).ReadBytes('\n')
+	if err == io.EOF && len(existing) == 0 {
+		recorder, err := NewRecorder(f, header, time.Now())
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		return recorder, f, nil
+	}
+	var existingHeader Header
+	if err != nil || json.Unmarshal(existing, &existingHeader) != nil || existingHeader.Version != Version {
+		f.Close()
+		return nil, nil, fmt.Errorf("%s is not an asciicast v%d recording", path, Version)
+	}
+	recorder := &Recorder{w: f, start: time.Unix(existingHeader.Timestamp, 0)}
+	if err := recorder.Resize(time.Now(), header.Width, header.Height); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return recorder, f, nil
+}
+
+// Write records data as printed now.
+func (r *Recorder) Write(data []byte) (int, error) {
+	if err := r.WriteAt(time.Now(), data); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// WriteAt records data as printed at t.
+func (r *Recorder) WriteAt(t time.Time, data []byte) error {
+	data = append(r.partial, data...)
+	r.partial = nil
+	// Keep an incomplete UTF-8 sequence at the end for the next write.
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				r.partial = append([]byte(nil), data[i:]...)
+				data = data[:i]
+			}
+			break
+		}
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return r.writeEvent(t, EventOutput, string(data))
+}
+
+// Resize records that the terminal was resized to width columns and height rows at t.
+func (r *Recorder) Resize(t time.Time, width int, height int) error {
+	return r.writeEvent(t, EventResize, fmt.Sprintf("%dx%d", width, height))
+}
+
+// writeEvent writes an event which happened at t.
+func (r *Recorder) writeEvent(t time.Time, eventType string, data string) error {
+	// Millisecond precision is plenty to play it back, and keeps the lines short.
+	seconds := float64(t.Sub(r.start).Milliseconds()) / 1000
+	line, err := json.Marshal(Event{Time: seconds, Type: eventType, Data: data})
+	if err != nil {
+		return err
+	}
+	if _, err := r.w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write event: %w", err)
+	}
+	return nil
+}
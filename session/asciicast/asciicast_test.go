@@ -0,0 +1,111 @@
+package asciicast
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAndRead(t *testing.T) {
+	var buf bytes.Buffer
+	start := time.Unix(1700000000, 0)
+	recorder, err := NewRecorder(&buf, Header{Width: 80, Height: 24}, start)
+	require.NoError(t, err)
+
+	// "é" is cut in two by the reads, it is recorded with the second one.
+	e := []byte("é")
+	require.NoError(t, recorder.WriteAt(start.Add(500*time.Millisecond), append([]byte("h"), e[0])))
+	require.NoError(t, recorder.WriteAt(start.Add(1250*time.Millisecond), append(e[1:], "llo\r\n"...)))
+
+	assert.Equal(t, `{"version":2,"width":80,"height":24,"timestamp":1700000000}
+[0.5,"o","h"]
+[1.25,"o","éllo\r\n"]
+`, buf.String())
+
+	header, events, err := Read(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, Header{Version: 2, Width: 80, Height: 24, Timestamp: 1700000000}, header)
+	assert.Equal(t, []Event{{Time: 0.5, Type: "o", Data: "h"}, {Time: 1.25, Type: "o", Data: "éllo\r\n"}}, events)
+
+	_, _, err = Read(strings.NewReader(`{"version":1}`))
+	assert.ErrorContains(t, err, "unsupported asciicast version 1")
+}
+
+func TestAppendFileContinuesRecording(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.cast")
+	recorder, f, err := AppendFile(path, Header{Width: 80, Height: 24})
+	require.NoError(t, err)
+	_, err = recorder.Write([]byte("first"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	recorder, f, err = AppendFile(path, Header{Width: 100, Height: 30})
+	require.NoError(t, err)
+	_, err = recorder.Write([]byte("second"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	header, events, err := ReadFile(path)
+	require.NoError(t, err)
+	// The header of the first recording is kept, the new size is recorded as a resize.
+	assert.Equal(t, 80, header.Width)
+	require.Len(t, events, 3)
+	assert.Equal(t, EventResize, events[1].Type)
+	assert.Equal(t, "100x30", events[1].Data)
+	assert.Equal(t, "second", events[2].Data)
+
+	require.NoError(t, os.WriteFile(path, []byte("not a recording\n"), 0644))
+	_, _, err = AppendFile(path, Header{})
+	assert.ErrorContains(t, err, "is not an asciicast v2 recording")
+}
+
+func TestPlayerSeek(t *testing.T) {
+	events := []Event{
+		{Time: 1, Type: "o", Data: "a"},
+		{Time: 2, Type: "i", Data: "typed"},
+		{Time: 60, Type: "o", Data: "b"},
+		{Time: 61, Type: "o", Data: "c"},
+	}
+	var out bytes.Buffer
+	player := NewPlayer(&out, Header{}, events, 1, 2*time.Second)
+	// The pause of almost a minute is shortened to 2 seconds, input isn't played.
+	assert.Equal(t, 4*time.Second, player.Duration())
+
+	require.NoError(t, player.Seek(3*time.Second))
+	assert.Equal(t, "ab", out.String())
+	assert.Equal(t, 3*time.Second, player.Position())
+
+	// Seeking backwards clears the screen and prints the recording up to the position again.
+	out.Reset()
+	require.NoError(t, player.Seek(time.Second))
+	assert.Equal(t, clearScreen+"a", out.String())
+
+	out.Reset()
+	require.NoError(t, player.Seek(time.Hour))
+	assert.Equal(t, "bc", out.String())
+	assert.Equal(t, 4*time.Second, player.Position())
+}
+
+func TestPlayerResizes(t *testing.T) {
+	events := []Event{
+		{Time: 1, Type: "o", Data: "a"},
+		{Time: 2, Type: "r", Data: "100x30"},
+		{Time: 3, Type: "o", Data: "b"},
+	}
+	var out bytes.Buffer
+	player := NewPlayer(&out, Header{Width: 80, Height: 24}, events, 1, 0)
+
+	require.NoError(t, player.Seek(3*time.Second))
+	assert.Equal(t, "\x1b[8;24;80ta\x1b[8;30;100tb", out.String())
+
+	// Seeking back to the start goes back to the size of the header.
+	out.Reset()
+	require.NoError(t, player.Seek(time.Second))
+	assert.Equal(t, clearScreen+"\x1b[8;24;80ta", out.String())
+}
@@ -0,0 +1,164 @@
+package asciicast
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// clearScreen resets the attributes and clears the screen and its scrollback, so seeking backwards can print
+// the recording up to the new position again.
+const clearScreen = "\x1b[0m\x1b[H\x1b[2J\x1b[3J"
+
+// Control changes the playback of a Player.
+type Control struct {
+	// Seek moves the position by the given duration of the recording, backwards if negative.
+	Seek time.Duration
+	// Speed multiplies the speed if it is not 0.
+	Speed float64
+	// TogglePause pauses or resumes the playback.
+	TogglePause bool
+}
+
+// Player plays a recording back on a terminal.
+type Player struct {
+	out io.Writer
+	// events are the output and resize events of the recording and times when they are played, in seconds
+	// of the recording with pauses shortened to the idle limit.
+	events []Event
+	times  []float64
+
+	speed float64
+	// position is the time of the recording shown, and next is the index of the next event to print.
+	position float64
+	next     int
+	paused   bool
+}
+
+// NewPlayer returns a player of the recording with header and events which prints to out. Pauses longer than
+// idleLimit are shortened to it, unless it is 0.
+func NewPlayer(out io.Writer, header Header, events []Event, speed float64, idleLimit time.Duration) *Player {
+	p := &Player{out: out, speed: speed}
+	if header.Width > 0 && header.Height > 0 {
+		// Start out at the size of the terminal recorded, also after seeking backwards.
+		p.events = append(p.events, Event{Type: EventResize, Data: fmt.Sprintf("%dx%d", header.Width, header.Height)})
+		p.times = append(p.times, 0)
+	}
+	var last, shortened float64
+	for _, event := range events {
+		if event.Type != EventOutput && event.Type != EventResize {
+			continue
+		}
+		pause := max(event.Time-last, 0)
+		if idleLimit > 0 {
+			pause = min(pause, idleLimit.Seconds())
+		}
+		last = max(event.Time, last)
+		shortened += pause
+		p.events = append(p.events, event)
+		p.times = append(p.times, shortened)
+	}
+	return p
+}
+
+// Duration returns how long the recording plays at normal speed.
+func (p *Player) Duration() time.Duration {
+	if len(p.times) == 0 {
+		return 0
+	}
+	return seconds(p.times[len(p.times)-1])
+}
+
+// Position returns the time of the recording shown.
+func (p *Player) Position() time.Duration {
+	return seconds(p.position)
+}
+
+// Seek prints the recording up to the time d without waiting, which may be before the time shown.
+func (p *Player) Seek(d time.Duration) error {
+	target := max(min(d.Seconds(), p.Duration().Seconds()), 0)
+	if target < p.position {
+		if _, err := io.WriteString(p.out, clearScreen); err != nil {
+			return err
+		}
+		p.next = 0
+	}
+	for p.next < len(p.events) && p.times[p.next] <= target {
+		if err := p.print(); err != nil {
+			return err
+		}
+	}
+	p.position = target
+	return nil
+}
+
+// Play plays the recording from the time shown until ctx is done or controls is closed. Without controls, it
+// returns at the end of the recording. Otherwise the end stays on screen, since the viewer may still seek back.
+func (p *Player) Play(ctx context.Context, controls <-chan Control) error {
+	for p.next < len(p.events) || controls != nil {
+		var timer <-chan time.Time
+		started := time.Now()
+		if !p.paused && p.next < len(p.events) {
+			wait := (p.times[p.next] - p.position) / p.speed
+			timer = time.After(seconds(wait))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer:
+			p.position = p.times[p.next]
+			if err := p.print(); err != nil {
+				return err
+			}
+		case control, ok := <-controls:
+			if !ok {
+				return nil
+			}
+			if !p.paused && p.next < len(p.events) {
+				p.position = min(p.position+time.Since(started).Seconds()*p.speed, p.times[p.next])
+			}
+			if err := p.apply(control); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// apply changes the playback as control asks for.
+func (p *Player) apply(control Control) error {
+	if control.TogglePause {
+		p.paused = !p.paused
+	}
+	if control.Speed != 0 {
+		p.speed *= control.Speed
+	}
+	if control.Seek != 0 {
+		return p.Seek(p.Position() + control.Seek)
+	}
+	return nil
+}
+
+// print prints the next event. Resizes ask the terminal to take the size of the recorded one, which not every
+// terminal does.
+func (p *Player) print() error {
+	event := p.events[p.next]
+	p.next++
+	if event.Type == EventResize {
+		var width, height int
+		if _, err := fmt.Sscanf(event.Data, "%dx%d", &width, &height); err != nil {
+			// Skip a broken resize, the output is more important.
+			return nil
+		}
+		_, err := fmt.Fprintf(p.out, "\x1b[8;%d;%dt", height, width)
+		return err
+	}
+	_, err := io.WriteString(p.out, event.Data)
+	return err
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
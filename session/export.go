@@ -0,0 +1,277 @@
+package session
+
+import (
+	"archive/tar"
+	"bytes"
+	"claude-squad/log"
+	"claude-squad/session/git"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// exportFormatVersion is the version of the archives written by ExportInstance. Archives with a newer
+// version are refused on import.
+const exportFormatVersion = 1
+
+// Files in an export archive.
+const (
+	exportManifestName   = "instance.json"
+	exportBundleName     = "branch.bundle"
+	exportScrollbackName = "scrollback.txt"
+)
+
+// exportRefPrefix is where the exported commit is kept while the bundle is created.
+const exportRefPrefix = "refs/claudesquad/export/"
+
+// ExportManifest describes an exported instance.
+type ExportManifest struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	// TipCommitSHA is the commit the imported branch points at. It includes the changes which were
+	// uncommitted when the instance was exported.
+	TipCommitSHA string `json:"tip_commit_sha"`
+	// Instance is the stored instance including its prompts.
+	Instance InstanceData `json:"instance"`
+}
+
+// ImportOptions configures ImportInstance.
+type ImportOptions struct {
+	// Path is a path within the repository the instance is imported into.
+	Path string
+	// Title and Branch replace the title and the branch name of the exported instance if they are set.
+	Title  string
+	Branch string
+}
+
+// ExportInstance writes a gzipped tar archive of a stored instance to w. It holds a git bundle with the
+// commits of the branch since the base commit, the stored instance with its prompts and the scrollback.
+// Uncommitted changes are included as an extra commit, the branch itself is left untouched.
+func (s *Storage) ExportInstance(data InstanceData, w io.Writer) error {
+	tmpDir, err := os.MkdirTemp("", "claudesquad-export-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	bundlePath := filepath.Join(tmpDir, exportBundleName)
+	message := fmt.Sprintf("[claudesquad] update from '%s' on %s (exported)", data.Title,
+		time.Now().Format(time.RFC822))
+	tip, bundled, err := data.GitWorktree().CreateBundle(bundlePath, exportRefPrefix+data.ID, message)
+	if err != nil {
+		return fmt.Errorf("failed to bundle branch %s: %w", data.Branch, err)
+	}
+
+	scrollback := data.ImportedScrollback
+	if data.Status != Paused && data.Status != Lost {
+		instance := FromInstanceDataDetached(data)
+		if content, err := instance.Scrollback("-", "-", false); err != nil {
+			log.WarningLog.Printf("could not capture scrollback of instance %s: %v", data.Title, err)
+		} else {
+			scrollback = content
+		}
+	}
+
+	manifest := ExportManifest{
+		Version:      exportFormatVersion,
+		ExportedAt:   time.Now(),
+		TipCommitSHA: tip,
+		Instance:     data,
+	}
+	// The scrollback has its own file.
+	manifest.Instance.ImportedScrollback = ""
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal instance: %w", err)
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	writeFile := func(name string, content []byte) error {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), ModTime: manifest.ExportedAt}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := tw.Write(content)
+		return err
+	}
+	if err := writeFile(exportManifestName, manifestJSON); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := writeFile(exportScrollbackName, []byte(scrollback)); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if bundled {
+		bundle, err := os.ReadFile(bundlePath)
+		if err != nil {
+			return fmt.Errorf("failed to read bundle: %w", err)
+		}
+		if err := writeFile(exportBundleName, bundle); err != nil {
+			return fmt.Errorf("failed to write archive: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := gw.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
+
+// ImportInstance reads an archive written by ExportInstance and registers its instance as paused in the
+// repository containing opts.Path, which must have the base commit of the instance. The branch is created
+// from the bundle and checked out into a new worktree. Existing branches are never overwritten.
+func (s *Storage) ImportInstance(r io.Reader, opts ImportOptions) (InstanceData, error) {
+	tmpDir, err := os.MkdirTemp("", "claudesquad-import-*")
+	if err != nil {
+		return InstanceData{}, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	manifest, scrollback, bundlePath, err := readExportArchive(r, tmpDir)
+	if err != nil {
+		return InstanceData{}, err
+	}
+
+	absPath, err := filepath.Abs(opts.Path)
+	if err != nil {
+		return InstanceData{}, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	repoPath, err := git.FindRepoRoot(absPath)
+	if err != nil {
+		return InstanceData{}, err
+	}
+
+	data := manifest.Instance
+	if opts.Title != "" {
+		data.Title = opts.Title
+	}
+	if opts.Branch != "" {
+		data.Branch = opts.Branch
+	}
+	if err := s.checkNewInstance(data.Title, data.Branch); err != nil {
+		return InstanceData{}, err
+	}
+	if git.BranchExists(repoPath, data.Branch) {
+		return InstanceData{}, fmt.Errorf("branch %s already exists in %s, pick another one with --branch",
+			data.Branch, repoPath)
+	}
+	baseCommit := data.Worktree.BaseCommitSHA
+	if baseCommit != "" && !git.HasCommit(repoPath, baseCommit) {
+		return InstanceData{}, fmt.Errorf("base commit %s of instance %s is missing from %s, fetch it first",
+			baseCommit, data.Title, repoPath)
+	}
+
+	id, err := newInstanceID()
+	if err != nil {
+		return InstanceData{}, err
+	}
+	worktreePath, err := git.WorktreePath(id)
+	if err != nil {
+		return InstanceData{}, err
+	}
+
+	if bundlePath != "" {
+		if err := git.FetchBundle(repoPath, bundlePath); err != nil {
+			return InstanceData{}, err
+		}
+	}
+	if err := git.RestoreBranch(repoPath, data.Branch, manifest.TipCommitSHA); err != nil {
+		return InstanceData{}, err
+	}
+
+	data.ID = id
+	data.Path = absPath
+	data.Status = Paused
+	data.LostReason = ""
+	data.UpdatedAt = time.Now()
+	data.ImportedScrollback = scrollback
+	data.Worktree = GitWorktreeData{
+		RepoPath:      repoPath,
+		WorktreePath:  worktreePath,
+		SessionName:   data.Title,
+		BranchName:    data.Branch,
+		BaseCommitSHA: baseCommit,
+	}
+
+	worktree := data.GitWorktree()
+	if err := worktree.SetupFromExistingBranch(); err != nil {
+		if cleanupErr := worktree.Cleanup(); cleanupErr != nil {
+			err = fmt.Errorf("%v (cleanup error: %v)", err, cleanupErr)
+		}
+		return InstanceData{}, err
+	}
+	if err := s.addInstanceData(data); err != nil {
+		if cleanupErr := worktree.Cleanup(); cleanupErr != nil {
+			err = fmt.Errorf("%v (cleanup error: %v)", err, cleanupErr)
+		}
+		return InstanceData{}, err
+	}
+	return data, nil
+}
+
+// readExportArchive unpacks an export archive. The bundle is written to dir. bundlePath is empty if the
+// archive has no bundle because the branch had no commits.
+func readExportArchive(r io.Reader, dir string) (manifest ExportManifest, scrollback string, bundlePath string,
+	err error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return manifest, "", "", fmt.Errorf("failed to read archive: %w", err)
+	}
+	defer gr.Close()
+
+	foundManifest := false
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return manifest, "", "", fmt.Errorf("failed to read archive: %w", err)
+		}
+		switch header.Name {
+		case exportManifestName:
+			if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+				return manifest, "", "", fmt.Errorf("failed to parse %s: %w", exportManifestName, err)
+			}
+			foundManifest = true
+		case exportScrollbackName:
+			var buf bytes.Buffer
+			if _, err := io.Copy(&buf, tr); err != nil {
+				return manifest, "", "", fmt.Errorf("failed to read archive: %w", err)
+			}
+			scrollback = buf.String()
+		case exportBundleName:
+			bundlePath = filepath.Join(dir, exportBundleName)
+			f, err := os.Create(bundlePath)
+			if err != nil {
+				return manifest, "", "", fmt.Errorf("failed to write bundle: %w", err)
+			}
+			_, err = io.Copy(f, tr)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return manifest, "", "", fmt.Errorf("failed to write bundle: %w", err)
+			}
+		}
+	}
+
+	if !foundManifest {
+		return manifest, "", "", fmt.Errorf("not an exported instance: %s is missing", exportManifestName)
+	}
+	if manifest.Version > exportFormatVersion {
+		return manifest, "", "", fmt.Errorf("the instance was exported by a newer version of claude-squad "+
+			"(format version %d, this version supports up to %d)", manifest.Version, exportFormatVersion)
+	}
+	if manifest.TipCommitSHA == "" {
+		return manifest, "", "", fmt.Errorf("%s has no tip commit", exportManifestName)
+	}
+	return manifest, scrollback, bundlePath, nil
+}
@@ -0,0 +1,182 @@
+package session
+
+import (
+	"archive/tar"
+	"bytes"
+	"claude-squad/config"
+	"claude-squad/log"
+	"claude-squad/session/git"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadExportArchive(t *testing.T) {
+	archive := func(files map[string]string) *bytes.Buffer {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gw)
+		for name, content := range files {
+			require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}))
+			_, err := tw.Write([]byte(content))
+			require.NoError(t, err)
+		}
+		require.NoError(t, tw.Close())
+		require.NoError(t, gw.Close())
+		return &buf
+	}
+	manifest := func(version int) string {
+		data, err := json.Marshal(ExportManifest{Version: version, TipCommitSHA: "abc", Instance: InstanceData{
+			Title:   "exported",
+			Prompts: []PromptRecord{{Text: "fix the tests"}},
+		}})
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	dir := t.TempDir()
+	got, scrollback, bundlePath, err := readExportArchive(archive(map[string]string{
+		exportManifestName:   manifest(exportFormatVersion),
+		exportScrollbackName: "$ make test",
+		exportBundleName:     "bundle",
+	}), dir)
+	require.NoError(t, err)
+	assert.Equal(t, "exported", got.Instance.Title)
+	assert.Equal(t, "fix the tests", got.Instance.Prompts[0].Text)
+	assert.Equal(t, "$ make test", scrollback)
+	bundle, err := os.ReadFile(bundlePath)
+	require.NoError(t, err)
+	assert.Equal(t, "bundle", string(bundle))
+
+	// Branches without commits since the base commit have no bundle.
+	_, _, bundlePath, err = readExportArchive(archive(map[string]string{
+		exportManifestName: manifest(exportFormatVersion),
+	}), t.TempDir())
+	require.NoError(t, err)
+	assert.Empty(t, bundlePath)
+
+	_, _, _, err = readExportArchive(archive(map[string]string{exportScrollbackName: ""}), t.TempDir())
+	assert.ErrorContains(t, err, "not an exported instance")
+
+	_, _, _, err = readExportArchive(archive(map[string]string{
+		exportManifestName: manifest(exportFormatVersion + 1),
+	}), t.TempDir())
+	assert.ErrorContains(t, err, "newer version")
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	log.Initialize(false)
+	defer log.Close()
+	t.Setenv("HOME", t.TempDir())
+	// The commits of the test and the snapshot of uncommitted changes need an identity.
+	for _, name := range []string{"GIT_AUTHOR", "GIT_COMMITTER"} {
+		t.Setenv(name+"_NAME", "test")
+		t.Setenv(name+"_EMAIL", "test@example.com")
+	}
+	runGit := func(dir string, args ...string) string {
+		output, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+		require.NoError(t, err, string(output))
+		return strings.TrimSpace(string(output))
+	}
+	writeFile := func(path string, content string) {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	source := t.TempDir()
+	runGit(source, "init", "-q")
+	writeFile(filepath.Join(source, "README"), "base\n")
+	runGit(source, "add", "README")
+	runGit(source, "commit", "-q", "-m", "base")
+	// The repository the instance is imported into has the base commit, but not the branch.
+	target := t.TempDir()
+	runGit(target, "clone", "-q", source, ".")
+
+	const id = "0123456789ab"
+	worktree, branch, err := git.NewGitWorktree(source, id, "feature", "")
+	require.NoError(t, err)
+	require.NoError(t, worktree.Setup())
+	worktreePath := worktree.GetWorktreePath()
+	writeFile(filepath.Join(worktreePath, "committed.txt"), "committed\n")
+	runGit(worktreePath, "add", "committed.txt")
+	runGit(worktreePath, "commit", "-q", "-m", "committed")
+	committed := runGit(worktreePath, "rev-parse", "HEAD")
+	// Uncommitted changes, tracked and untracked, end up in the export as an extra commit.
+	writeFile(filepath.Join(worktreePath, "README"), "changed\n")
+	writeFile(filepath.Join(worktreePath, "untracked.txt"), "untracked\n")
+
+	state, err := config.LoadState()
+	require.NoError(t, err)
+	storage, err := NewStorage(state)
+	require.NoError(t, err)
+	data := InstanceData{
+		ID:      id,
+		Title:   "feature",
+		Branch:  branch,
+		Status:  Ready,
+		Prompts: []PromptRecord{{Text: "fix the tests"}},
+		Worktree: GitWorktreeData{
+			RepoPath:      worktree.GetRepoPath(),
+			WorktreePath:  worktreePath,
+			SessionName:   "feature",
+			BranchName:    branch,
+			BaseCommitSHA: worktree.GetBaseCommitSHA(),
+		},
+	}
+	var archive bytes.Buffer
+	require.NoError(t, storage.ExportInstance(data, &archive))
+
+	// Exporting leaves the branch and the worktree alone.
+	assert.Equal(t, committed, runGit(source, "rev-parse", branch))
+	assert.Contains(t, runGit(worktreePath, "status", "--porcelain"), "untracked.txt")
+
+	imported, err := storage.ImportInstance(bytes.NewReader(archive.Bytes()), ImportOptions{Path: target})
+	require.NoError(t, err)
+	assert.Equal(t, Paused, imported.Status)
+	assert.Equal(t, branch, imported.Branch)
+	assert.Equal(t, "fix the tests", imported.Prompts[0].Text)
+	assert.Equal(t, committed, runGit(target, "rev-parse", branch+"^"))
+	for file, content := range map[string]string{
+		"README":        "changed",
+		"committed.txt": "committed",
+		"untracked.txt": "untracked",
+	} {
+		assert.Equal(t, content, runGit(target, "show", branch+":"+file))
+		checkedOut, err := os.ReadFile(filepath.Join(imported.Worktree.WorktreePath, file))
+		require.NoError(t, err)
+		assert.Equal(t, content+"\n", string(checkedOut))
+	}
+
+	// Existing branches are never overwritten.
+	runGit(target, "branch", "taken")
+	_, err = storage.ImportInstance(bytes.NewReader(archive.Bytes()), ImportOptions{
+		Path:   target,
+		Title:  "again",
+		Branch: "taken",
+	})
+	assert.ErrorContains(t, err, "branch taken already exists")
+
+	// A repository without the base commit can't take the branch.
+	unrelated := t.TempDir()
+	runGit(unrelated, "init", "-q")
+	writeFile(filepath.Join(unrelated, "README"), "unrelated\n")
+	runGit(unrelated, "add", "README")
+	runGit(unrelated, "commit", "-q", "-m", "unrelated")
+	_, err = storage.ImportInstance(bytes.NewReader(archive.Bytes()), ImportOptions{
+		Path:   unrelated,
+		Title:  "elsewhere",
+		Branch: "elsewhere",
+	})
+	assert.ErrorContains(t, err, "is missing from")
+
+	instancesData, err := storage.LoadInstanceData()
+	require.NoError(t, err)
+	require.Len(t, instancesData, 1)
+	assert.Equal(t, imported.ID, instancesData[0].ID)
+}
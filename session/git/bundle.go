@@ -0,0 +1,80 @@
+package git
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// CreateBundle writes a git bundle to path with the commits of the branch since the base commit.
+// Uncommitted changes in the worktree are included as an extra commit on top, like KeepRef does. ref is
+// a temporary ref pointing at the bundled commit, which is deleted again. The SHA of the bundled commit is
+// returned. If there is nothing to bundle because the branch is still at the base commit, no bundle is
+// written and bundled is false.
+func (g *GitWorktree) CreateBundle(path string, ref string, snapshotMessage string) (tip string, bundled bool, err error) {
+	tip, err = g.KeepRef(ref, snapshotMessage)
+	if err != nil {
+		return "", false, err
+	}
+	defer func() {
+		if _, delErr := g.runGitCommand(g.repoPath, "update-ref", "-d", ref); delErr != nil && err == nil {
+			err = fmt.Errorf("failed to delete %s: %w", ref, delErr)
+		}
+	}()
+
+	if tip == g.baseCommitSHA {
+		return tip, false, nil
+	}
+	revs := ref
+	if g.baseCommitSHA != "" {
+		revs = g.baseCommitSHA + ".." + ref
+	}
+	if _, err := g.runGitCommand(g.repoPath, "bundle", "create", path, revs); err != nil {
+		return "", false, fmt.Errorf("failed to create bundle: %w", err)
+	}
+	return tip, true, nil
+}
+
+// HasCommit returns true if the commit exists in the repository.
+func HasCommit(repoPath string, sha string) bool {
+	return exec.Command("git", "-C", repoPath, "cat-file", "-e", sha+"^{commit}").Run() == nil
+}
+
+// BranchExists returns true if the branch exists in the repository.
+func BranchExists(repoPath string, branch string) bool {
+	return exec.Command("git", "-C", repoPath, "show-ref", "--verify", "--quiet", "refs/heads/"+branch).Run() == nil
+}
+
+// FetchBundle fetches the commits of the bundle at path into the repository without creating any refs.
+// The commits the bundle was created on top of have to exist in the repository already.
+func FetchBundle(repoPath string, path string) error {
+	run := func(args ...string) (string, error) {
+		cmd := exec.Command("git", append([]string{"-C", repoPath}, args...)...)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("%s (%w)", strings.TrimSpace(string(output)), err)
+		}
+		return string(output), nil
+	}
+
+	if _, err := run("bundle", "verify", path); err != nil {
+		return fmt.Errorf("bundle can't be applied to %s: %w", repoPath, err)
+	}
+	heads, err := run("bundle", "list-heads", path)
+	if err != nil {
+		return fmt.Errorf("failed to read bundle: %w", err)
+	}
+	var refs []string
+	for _, line := range strings.Split(strings.TrimSpace(heads), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 {
+			refs = append(refs, fields[1])
+		}
+	}
+	if len(refs) == 0 {
+		return fmt.Errorf("bundle %s has no refs", path)
+	}
+	if _, err := run(append([]string{"fetch", "--no-tags", "--quiet", path}, refs...)...); err != nil {
+		return fmt.Errorf("failed to fetch bundle: %w", err)
+	}
+	return nil
+}
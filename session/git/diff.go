@@ -1,6 +1,8 @@
 package git
 
 import (
+	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -25,27 +27,91 @@ func (d *DiffStats) IsEmpty() bool {
 func (g *GitWorktree) Diff() *DiffStats {
 	stats := &DiffStats{}
 
-	// -N stages untracked files (intent to add), including them in the diff
-	_, err := g.runGitCommand(g.worktreePath, "add", "-N", ".")
+	content, err := g.DiffWorktree()
 	if err != nil {
 		stats.Error = err
 		return stats
 	}
+	stats.Added, stats.Removed = CountChanges(content)
+	stats.Content = content
 
-	content, err := g.runGitCommand(g.worktreePath, "--no-pager", "diff", g.GetBaseCommitSHA())
-	if err != nil {
-		stats.Error = err
-		return stats
-	}
-	lines := strings.Split(content, "\n")
-	for _, line := range lines {
+	return stats
+}
+
+// CountChanges returns the number of added and removed lines in a patch.
+func CountChanges(patch string) (added int, removed int) {
+	for _, line := range strings.Split(patch, "\n") {
 		if strings.HasPrefix(line, "+") && !strings.HasPrefix(line, "+++") {
-			stats.Added++
+			added++
 		} else if strings.HasPrefix(line, "-") && !strings.HasPrefix(line, "---") {
-			stats.Removed++
+			removed++
 		}
 	}
-	stats.Content = content
+	return added, removed
+}
 
-	return stats
+// FileDiffStats holds the number of changed lines for a single file in a diff.
+type FileDiffStats struct {
+	Path    string `json:"path"`
+	Added   int    `json:"added"`
+	Removed int    `json:"removed"`
+}
+
+// DiffWorktree returns the output of git diff between the worktree and the base commit. args are
+// passed to git diff before the base commit, e.g. "--stat".
+func (g *GitWorktree) DiffWorktree(args ...string) (string, error) {
+	// -N stages untracked files (intent to add), including them in the diff
+	if _, err := g.runGitCommand(g.worktreePath, "add", "-N", "."); err != nil {
+		return "", err
+	}
+
+	diffArgs := append([]string{"--no-pager", "diff"}, args...)
+	return g.runGitCommand(g.worktreePath, append(diffArgs, g.GetBaseCommitSHA())...)
+}
+
+// DiffBranch returns the output of git diff between the base commit and the tip of the branch. It
+// doesn't need the worktree, so it works for paused instances. args are passed to git diff before the
+// commits.
+func (g *GitWorktree) DiffBranch(args ...string) (string, error) {
+	diffArgs := append([]string{"--no-pager", "diff"}, args...)
+	return g.runGitCommand(g.repoPath, append(diffArgs, g.GetBaseCommitSHA(), g.branchName)...)
+}
+
+// DiffCommit returns the output of git diff between the base commit and commit. args are passed to git
+// diff before the commits.
+func (g *GitWorktree) DiffCommit(commit string, args ...string) (string, error) {
+	diffArgs := append([]string{"--no-pager", "diff"}, args...)
+	return g.runGitCommand(g.repoPath, append(diffArgs, g.GetBaseCommitSHA(), commit)...)
+}
+
+// ParseNumStat parses the output of git diff --numstat. Binary files are reported with zero counts.
+func ParseNumStat(output string) ([]FileDiffStats, error) {
+	var files []FileDiffStats
+	for _, line := range strings.Split(output, "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("unexpected numstat line: %q", line)
+		}
+		file := FileDiffStats{Path: fields[2]}
+		// Binary files are reported as "-".
+		if fields[0] != "-" {
+			added, err := strconv.Atoi(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("unexpected numstat line: %q", line)
+			}
+			file.Added = added
+		}
+		if fields[1] != "-" {
+			removed, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("unexpected numstat line: %q", line)
+			}
+			file.Removed = removed
+		}
+		files = append(files, file)
+	}
+	return files, nil
 }
@@ -0,0 +1,24 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNumStat(t *testing.T) {
+	files, err := ParseNumStat("3\t1\tmain.go\n-\t-\tassets/logo.png\n0\t12\tdir with space/old.txt\n")
+	require.NoError(t, err)
+	require.Equal(t, []FileDiffStats{
+		{Path: "main.go", Added: 3, Removed: 1},
+		{Path: "assets/logo.png"},
+		{Path: "dir with space/old.txt", Removed: 12},
+	}, files)
+
+	files, err = ParseNumStat("")
+	require.NoError(t, err)
+	require.Empty(t, files)
+
+	_, err = ParseNumStat("garbage")
+	require.Error(t, err)
+}
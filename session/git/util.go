@@ -84,3 +84,13 @@ func findGitRepoRoot(path string) (string, error) {
 		currentPath = parent
 	}
 }
+
+// FindRepoRoot returns the root of the repository containing path, which is the repo path recorded for
+// instances created from there.
+func FindRepoRoot(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	return findGitRepoRoot(absPath)
+}
@@ -5,7 +5,6 @@ import (
 	"claude-squad/log"
 	"fmt"
 	"path/filepath"
-	"time"
 )
 
 func getWorktreeDirectory() (string, error) {
@@ -17,6 +16,15 @@ func getWorktreeDirectory() (string, error) {
 	return filepath.Join(configDir, "worktrees"), nil
 }
 
+// WorktreePath returns where the worktree of the instance with the given ID is created.
+func WorktreePath(id string) (string, error) {
+	worktreeDir, err := getWorktreeDirectory()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(worktreeDir, id), nil
+}
+
 // GitWorktree manages git worktree operations for a session
 type GitWorktree struct {
 	// Path to the repository
@@ -29,6 +37,8 @@ type GitWorktree struct {
 	branchName string
 	// Base commit hash for the worktree
 	baseCommitSHA string
+	// baseRef is the ref new worktrees are created from. Empty means HEAD.
+	baseRef string
 }
 
 func NewGitWorktreeFromStorage(repoPath string, worktreePath string, sessionName string, branchName string, baseCommitSHA string) *GitWorktree {
@@ -41,11 +51,18 @@ func NewGitWorktreeFromStorage(repoPath string, worktreePath string, sessionName
 	}
 }
 
-// NewGitWorktree creates a new GitWorktree instance
-func NewGitWorktree(repoPath string, sessionName string) (tree *GitWorktree, branchname string, err error) {
-	cfg := config.LoadConfig()
-	sanitizedName := sanitizeBranchName(sessionName)
-	branchName := fmt.Sprintf("%s%s", cfg.BranchPrefix, sanitizedName)
+// BranchName returns the name of the branch created for a session in the repository at repoPath, whose
+// project config may set the branch prefix.
+func BranchName(repoPath string, sessionName string) string {
+	cfg := config.LoadConfigFor(repoPath)
+	return fmt.Sprintf("%s%s", cfg.BranchPrefix, sanitizeBranchName(sessionName))
+}
+
+// NewGitWorktree creates a new GitWorktree instance. The worktree directory is named after id and the
+// branch after sessionName. baseRef is the branch, tag or commit the worktree is created from. If it's
+// empty, the worktree is created from HEAD.
+func NewGitWorktree(repoPath string, id string, sessionName string, baseRef string) (tree *GitWorktree, branchname string, err error) {
+	branchName := BranchName(repoPath, sessionName)
 
 	// Convert repoPath to absolute path
 	absPath, err := filepath.Abs(repoPath)
@@ -60,19 +77,17 @@ func NewGitWorktree(repoPath string, sessionName string) (tree *GitWorktree, bra
 		return nil, "", err
 	}
 
-	worktreeDir, err := getWorktreeDirectory()
+	worktreePath, err := WorktreePath(id)
 	if err != nil {
 		return nil, "", err
 	}
 
-	worktreePath := filepath.Join(worktreeDir, sanitizedName)
-	worktreePath = worktreePath + "_" + fmt.Sprintf("%x", time.Now().UnixNano())
-
 	return &GitWorktree{
 		repoPath:     repoPath,
 		sessionName:  sessionName,
 		branchName:   branchName,
 		worktreePath: worktreePath,
+		baseRef:      baseRef,
 	}, branchName, nil
 }
 
@@ -3,6 +3,7 @@ package git
 import (
 	"claude-squad/log"
 	"fmt"
+	"os"
 	"os/exec"
 	"strings"
 )
@@ -110,3 +111,77 @@ func (g *GitWorktree) OpenBranchURL() error {
 	}
 	return nil
 }
+
+// KeepRef points ref at the tip of the branch, so its commits survive deleting the branch. Uncommitted
+// changes in the worktree are included as an extra commit on top, without modifying the branch itself.
+// The SHA of the kept commit is returned.
+func (g *GitWorktree) KeepRef(ref string, snapshotMessage string) (string, error) {
+	output, err := g.runGitCommand(g.repoPath, "rev-parse", "--verify", "refs/heads/"+g.branchName+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve branch %s: %w", g.branchName, err)
+	}
+	commit := strings.TrimSpace(output)
+
+	if _, err := os.Stat(g.worktreePath); err == nil {
+		if dirty, err := g.IsDirty(); err != nil {
+			log.ErrorLog.Printf("failed to check if worktree is dirty, keeping the branch only: %v", err)
+		} else if dirty {
+			snapshot, err := g.snapshotWorktree(commit, snapshotMessage)
+			if err != nil {
+				log.ErrorLog.Printf("failed to snapshot uncommitted changes, keeping the branch only: %v", err)
+			} else {
+				commit = snapshot
+			}
+		}
+	}
+
+	if _, err := g.runGitCommand(g.repoPath, "update-ref", ref, commit); err != nil {
+		return "", fmt.Errorf("failed to update %s: %w", ref, err)
+	}
+	return commit, nil
+}
+
+// snapshotWorktree commits everything in the worktree, including untracked files, on top of parent. A
+// temporary index is used, so the worktree, its index and the branch are left untouched.
+func (g *GitWorktree) snapshotWorktree(parent string, message string) (string, error) {
+	indexFile, err := os.CreateTemp("", "claudesquad-index-*")
+	if err != nil {
+		return "", err
+	}
+	indexPath := indexFile.Name()
+	indexFile.Close()
+	// git refuses to read an empty index file, it has to create it.
+	os.Remove(indexPath)
+	defer os.Remove(indexPath)
+
+	run := func(args ...string) (string, error) {
+		cmd := exec.Command("git", append([]string{"-C", g.worktreePath}, args...)...)
+		cmd.Env = append(os.Environ(), "GIT_INDEX_FILE="+indexPath)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("git command failed: %s (%w)", output, err)
+		}
+		return strings.TrimSpace(string(output)), nil
+	}
+
+	if _, err := run("read-tree", parent); err != nil {
+		return "", err
+	}
+	if _, err := run("add", "-A"); err != nil {
+		return "", err
+	}
+	tree, err := run("write-tree")
+	if err != nil {
+		return "", err
+	}
+	return run("commit-tree", tree, "-p", parent, "-m", message)
+}
+
+// RestoreBranch creates branch in the repository at ref. Existing branches are never overwritten.
+func RestoreBranch(repoPath string, branch string, ref string) error {
+	cmd := exec.Command("git", "-C", repoPath, "branch", branch, ref)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create branch %s: %s (%w)", branch, strings.TrimSpace(string(output)), err)
+	}
+	return nil
+}
@@ -1,19 +1,26 @@
 package session
 
 import (
+	"claude-squad/config"
 	"claude-squad/log"
 	"claude-squad/session/git"
 	"claude-squad/session/tmux"
+	"crypto/rand"
+	"encoding/hex"
 	"path/filepath"
 
 	"fmt"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/atotto/clipboard"
 )
 
+// GlobalInstanceLimit is the maximum number of instances which can exist at the same time.
+const GlobalInstanceLimit = 10
+
 type Status int
 
 const (
@@ -25,11 +32,34 @@ const (
 	Loading
 	// Paused is if the instance is paused (worktree removed but branch preserved).
 	Paused
+	// Lost is if the tmux session or the worktree of a stored instance disappeared, e.g. after a reboot.
+	// The instance can be repaired or discarded. See LostReason.
+	Lost
 )
 
+func (s Status) String() string {
+	switch s {
+	case Running:
+		return "running"
+	case Ready:
+		return "ready"
+	case Loading:
+		return "loading"
+	case Paused:
+		return "paused"
+	case Lost:
+		return "lost"
+	default:
+		return "unknown"
+	}
+}
+
 // Instance is a running instance of claude code.
 type Instance struct {
-	// Title is the title of the instance.
+	// ID uniquely identifies the instance. It is generated once and never changes, so it names the tmux
+	// session and the worktree directory.
+	ID string
+	// Title is the title of the instance. It is only a label and can be changed at any time.
 	Title string
 	// Path is the path to the workspace.
 	Path string
@@ -51,15 +81,22 @@ type Instance struct {
 	AutoYes bool
 	// Prompt is the initial prompt to pass to the instance on startup
 	Prompt string
+	// LostReason explains why the instance is lost. It is empty unless the status is Lost.
+	LostReason string
 
 	// DiffStats stores the current git diff statistics
 	diffStats *git.DiffStats
+	// baseRef is the ref the worktree is created from on the first start. Empty means HEAD.
+	baseRef string
 
 	// The below fields are initialized upon calling Start().
 
 	started bool
 	// tmuxSession is the tmux session for the instance.
 	tmuxSession *tmux.TmuxSession
+	// previewWindow is the window of the session which is previewed and attached to. Empty means the window
+	// of the program.
+	previewWindow string
 	// gitWorktree is the git worktree for the instance.
 	gitWorktree *git.GitWorktree
 }
@@ -67,16 +104,18 @@ type Instance struct {
 // ToInstanceData converts an Instance to its serializable form
 func (i *Instance) ToInstanceData() InstanceData {
 	data := InstanceData{
-		Title:     i.Title,
-		Path:      i.Path,
-		Branch:    i.Branch,
-		Status:    i.Status,
-		Height:    i.Height,
-		Width:     i.Width,
-		CreatedAt: i.CreatedAt,
-		UpdatedAt: time.Now(),
-		Program:   i.Program,
-		AutoYes:   i.AutoYes,
+		ID:         i.ID,
+		Title:      i.Title,
+		Path:       i.Path,
+		Branch:     i.Branch,
+		Status:     i.Status,
+		Height:     i.Height,
+		Width:      i.Width,
+		CreatedAt:  i.CreatedAt,
+		UpdatedAt:  time.Now(),
+		Program:    i.Program,
+		AutoYes:    i.AutoYes,
+		LostReason: i.LostReason,
 	}
 
 	// Only include worktree data if gitWorktree is initialized
@@ -102,42 +141,87 @@ func (i *Instance) ToInstanceData() InstanceData {
 	return data
 }
 
-// FromInstanceData creates a new Instance from serialized data
-func FromInstanceData(data InstanceData) (*Instance, error) {
-	instance := &Instance{
-		Title:     data.Title,
-		Path:      data.Path,
-		Branch:    data.Branch,
-		Status:    data.Status,
-		Height:    data.Height,
-		Width:     data.Width,
-		CreatedAt: data.CreatedAt,
-		UpdatedAt: data.UpdatedAt,
-		Program:   data.Program,
-		gitWorktree: git.NewGitWorktreeFromStorage(
-			data.Worktree.RepoPath,
-			data.Worktree.WorktreePath,
-			data.Worktree.SessionName,
-			data.Worktree.BranchName,
-			data.Worktree.BaseCommitSHA,
-		),
-		diffStats: &git.DiffStats{
-			Added:   data.DiffStats.Added,
-			Removed: data.DiffStats.Removed,
-			Content: data.DiffStats.Content,
-		},
-	}
+// FromInstanceData creates a new Instance from serialized data and attaches to its tmux session. Instances
+// whose tmux session or worktree is gone can't be attached to, so they are returned with the Lost status
+// instead. Lost instances which turn out to be fine again are restored as usual.
+func FromInstanceData(data InstanceData) *Instance {
+	instance := newInstanceFromData(data)
+	instance.tmuxSession = tmux.NewTmuxSession(instance.ID, instance.Program, instance.Path)
 
 	if instance.Paused() {
 		instance.started = true
-		instance.tmuxSession = tmux.NewTmuxSession(instance.Title, instance.Program)
-	} else {
-		if err := instance.Start(false); err != nil {
-			return nil, err
+		return instance
+	}
+
+	if reason := instance.missingResources(); reason != "" {
+		instance.markLost(reason)
+		return instance
+	}
+	if err := instance.Start(false); err != nil {
+		instance.markLost(err.Error())
+		return instance
+	}
+	instance.LostReason = ""
+	return instance
+}
+
+// missingResources describes which of the tmux session and the worktree of a stored instance are gone.
+// It returns an empty string if both exist.
+func (i *Instance) missingResources() string {
+	var missing []string
+	worktreePath := i.gitWorktree.GetWorktreePath()
+	if _, err := os.Stat(worktreePath); err != nil {
+		if os.IsNotExist(err) {
+			missing = append(missing, fmt.Sprintf("worktree %s is missing", worktreePath))
+		} else {
+			missing = append(missing, fmt.Sprintf("worktree %s can't be accessed: %v", worktreePath, err))
 		}
 	}
+	if !i.tmuxSession.DoesSessionExist() {
+		missing = append(missing, "tmux session is gone")
+	}
+	return strings.Join(missing, ", ")
+}
+
+// markLost marks a loaded instance as lost. It counts as started, like paused instances, so it can be
+// repaired or killed.
+func (i *Instance) markLost(reason string) {
+	i.started = true
+	i.Status = Lost
+	i.LostReason = reason
+}
 
-	return instance, nil
+// FromInstanceDataDetached creates a new Instance from serialized data without attaching to its tmux
+// session, the same way paused instances are loaded. Detached instances can be inspected, paused,
+// resumed and killed, but they can't receive input.
+func FromInstanceDataDetached(data InstanceData) *Instance {
+	instance := newInstanceFromData(data)
+	instance.started = true
+	instance.tmuxSession = tmux.NewTmuxSession(instance.ID, instance.Program, instance.Path)
+	return instance
+}
+
+func newInstanceFromData(data InstanceData) *Instance {
+	return &Instance{
+		ID:          data.ID,
+		Title:       data.Title,
+		Path:        data.Path,
+		Branch:      data.Branch,
+		Status:      data.Status,
+		Height:      data.Height,
+		Width:       data.Width,
+		CreatedAt:   data.CreatedAt,
+		UpdatedAt:   data.UpdatedAt,
+		Program:     data.Program,
+		AutoYes:     data.AutoYes,
+		LostReason:  data.LostReason,
+		gitWorktree: data.GitWorktree(),
+		diffStats: &git.DiffStats{
+			Added:   data.DiffStats.Added,
+			Removed: data.DiffStats.Removed,
+			Content: data.DiffStats.Content,
+		},
+	}
 }
 
 // Options for creating a new instance
@@ -148,8 +232,10 @@ type InstanceOptions struct {
 	Path string
 	// Program is the program to run in the instance (e.g. "claude", "aider --model ollama_chat/gemma3:1b")
 	Program string
-	// If AutoYes is true, then
+	// If AutoYes is true, then the instance automatically accepts prompts.
 	AutoYes bool
+	// BaseRef is the branch, tag or commit to create the instance's worktree from. Defaults to HEAD.
+	BaseRef string
 }
 
 func NewInstance(opts InstanceOptions) (*Instance, error) {
@@ -161,7 +247,13 @@ func NewInstance(opts InstanceOptions) (*Instance, error) {
 		return nil, fmt.Errorf("failed to get absolute path: %w", err)
 	}
 
+	id, err := newInstanceID()
+	if err != nil {
+		return nil, err
+	}
+
 	return &Instance{
+		ID:        id,
 		Title:     opts.Title,
 		Status:    Ready,
 		Path:      absPath,
@@ -170,10 +262,20 @@ func NewInstance(opts InstanceOptions) (*Instance, error) {
 		Width:     0,
 		CreatedAt: t,
 		UpdatedAt: t,
-		AutoYes:   false,
+		AutoYes:   opts.AutoYes,
+		baseRef:   opts.BaseRef,
 	}, nil
 }
 
+// newInstanceID generates a random instance ID.
+func newInstanceID() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate instance ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
 func (i *Instance) RepoName() (string, error) {
 	if !i.started {
 		return "", fmt.Errorf("cannot get repo name for instance that has not been started")
@@ -190,12 +292,15 @@ func (i *Instance) Start(firstTimeSetup bool) error {
 	if i.Title == "" {
 		return fmt.Errorf("instance title cannot be empty")
 	}
+	if i.ID == "" {
+		return fmt.Errorf("instance %s has no ID", i.Title)
+	}
 
-	tmuxSession := tmux.NewTmuxSession(i.Title, i.Program)
+	tmuxSession := tmux.NewTmuxSession(i.ID, i.Program, i.Path)
 	i.tmuxSession = tmuxSession
 
 	if firstTimeSetup {
-		gitWorktree, branchName, err := git.NewGitWorktree(i.Path, i.Title)
+		gitWorktree, branchName, err := git.NewGitWorktree(i.Path, i.ID, i.Title, i.baseRef)
 		if err != nil {
 			return fmt.Errorf("failed to create git worktree: %w", err)
 		}
@@ -203,10 +308,14 @@ func (i *Instance) Start(firstTimeSetup bool) error {
 		i.Branch = branchName
 	}
 
-	// Setup error handler to cleanup resources on any error
+	// Setup error handler to cleanup resources on any error. The resources of restored instances are
+	// left alone, they may hold work which can still be recovered.
 	var setupErr error
 	defer func() {
 		if setupErr != nil {
+			if !firstTimeSetup {
+				return
+			}
 			if cleanupErr := i.Kill(); cleanupErr != nil {
 				setupErr = fmt.Errorf("%v (cleanup error: %v)", setupErr, cleanupErr)
 			}
@@ -254,8 +363,9 @@ func (i *Instance) Kill() error {
 	var errs []error
 
 	// Always try to cleanup both resources, even if one fails
-	// Clean up tmux session first since it's using the git worktree
-	if i.tmuxSession != nil {
+	// Clean up tmux session first since it's using the git worktree. Paused instances have no session and
+	// the session of a lost instance may not exist anymore.
+	if i.tmuxSession != nil && ((i.Status != Lost && i.Status != Paused) || i.tmuxSession.DoesSessionExist()) {
 		if err := i.tmuxSession.Close(); err != nil {
 			errs = append(errs, fmt.Errorf("failed to close tmux session: %w", err))
 		}
@@ -295,15 +405,83 @@ func (i *Instance) Close() error {
 	return i.Kill()
 }
 
+// Preview returns the content of the previewed window. Companions which aren't running return
+// tmux.ErrWindowNotRunning.
 func (i *Instance) Preview() (string, error) {
-	if !i.started || i.Status == Paused {
+	if !i.started || i.Status == Paused || i.Status == Lost {
+		return "", nil
+	}
+	return i.tmuxSession.CaptureWindow(i.previewWindow)
+}
+
+// PreviewScrollback is like Preview, but includes the history of the window.
+func (i *Instance) PreviewScrollback() (string, error) {
+	if !i.started || i.Status == Paused || i.Status == Lost {
 		return "", nil
 	}
-	return i.tmuxSession.CapturePaneContent()
+	return i.tmuxSession.CaptureWindowScrollback(i.previewWindow)
+}
+
+// Windows returns the names of the windows of the instance: the one of the program followed by the companions.
+func (i *Instance) Windows() []string {
+	windows := []string{config.AgentWindowName}
+	if i.tmuxSession != nil {
+		windows = append(windows, i.tmuxSession.Companions()...)
+	}
+	return windows
+}
+
+// PreviewWindow returns the name of the window which is previewed and attached to.
+func (i *Instance) PreviewWindow() string {
+	if i.previewWindow == "" {
+		return config.AgentWindowName
+	}
+	return i.previewWindow
+}
+
+// SelectWindow selects the window which is previewed and attached to.
+func (i *Instance) SelectWindow(name string) error {
+	if !slices.Contains(i.Windows(), name) {
+		return fmt.Errorf("instance %s has no window %q, its windows are: %s", i.Title, name,
+			strings.Join(i.Windows(), ", "))
+	}
+	i.previewWindow = name
+	if name == config.AgentWindowName {
+		i.previewWindow = ""
+	}
+	return nil
+}
+
+// CycleWindow selects the next window to preview and attach to, wrapping around to the program's.
+func (i *Instance) CycleWindow() {
+	windows := i.Windows()
+	next := (slices.Index(windows, i.PreviewWindow()) + 1) % len(windows)
+	_ = i.SelectWindow(windows[next])
+}
+
+// Scrollback captures the pane's lines between start and end, where negative numbers address the history
+// and "-" means its start or the end of the visible screen. Escape sequences are kept if ansi is true.
+func (i *Instance) Scrollback(start, end string, ansi bool) (string, error) {
+	if !i.started || i.Status == Paused || i.Status == Lost {
+		return "", fmt.Errorf("cannot capture scrollback of instance that has not been started, is paused or is lost")
+	}
+	if ansi {
+		return i.tmuxSession.CapturePaneContentWithOptions(start, end)
+	}
+	return i.tmuxSession.CapturePaneTextWithOptions(start, end)
+}
+
+// HistoryAndCursor returns the number of lines which have scrolled off the visible screen of the pane, and
+// the row of the cursor on the visible screen.
+func (i *Instance) HistoryAndCursor() (history int, cursorY int, err error) {
+	if !i.started || i.Status == Paused || i.Status == Lost {
+		return 0, 0, fmt.Errorf("cannot get history of instance that has not been started, is paused or is lost")
+	}
+	return i.tmuxSession.HistoryAndCursor()
 }
 
 func (i *Instance) HasUpdated() (updated bool, hasPrompt bool) {
-	if !i.started {
+	if !i.started || i.Status == Lost {
 		return false, false
 	}
 	return i.tmuxSession.HasUpdated()
@@ -311,7 +489,7 @@ func (i *Instance) HasUpdated() (updated bool, hasPrompt bool) {
 
 // TapEnter sends an enter key press to the tmux session if AutoYes is enabled.
 func (i *Instance) TapEnter() {
-	if !i.started || !i.AutoYes {
+	if !i.started || !i.AutoYes || i.Status == Lost {
 		return
 	}
 	if err := i.tmuxSession.TapEnter(); err != nil {
@@ -319,17 +497,29 @@ func (i *Instance) TapEnter() {
 	}
 }
 
+// Disconnect releases the PTY attached to the instance's tmux session without stopping the session. This
+// is used by long running processes which only need to talk to an instance briefly.
+func (i *Instance) Disconnect() error {
+	if !i.started || i.tmuxSession == nil {
+		return nil
+	}
+	return i.tmuxSession.Disconnect()
+}
+
 func (i *Instance) Attach() (chan struct{}, error) {
 	if !i.started {
 		return nil, fmt.Errorf("cannot attach instance that has not been started")
 	}
-	return i.tmuxSession.Attach()
+	if i.Status == Lost {
+		return nil, fmt.Errorf("cannot attach lost instance %s: %s", i.Title, i.LostReason)
+	}
+	return i.tmuxSession.AttachWindow(i.previewWindow)
 }
 
 func (i *Instance) SetPreviewSize(width, height int) error {
-	if !i.started || i.Status == Paused {
-		return fmt.Errorf("cannot set preview size for instance that has not been started or " +
-			"is paused")
+	if !i.started || i.Status == Paused || i.Status == Lost {
+		return fmt.Errorf("cannot set preview size for instance that has not been started, " +
+			"is paused or is lost")
 	}
 	return i.tmuxSession.SetDetachedSize(width, height)
 }
@@ -346,12 +536,9 @@ func (i *Instance) Started() bool {
 	return i.started
 }
 
-// SetTitle sets the title of the instance. Returns an error if the instance has started.
-// We cant change the title once it's been used for a tmux session etc.
+// SetTitle sets the title of the instance. Since the tmux session and worktree are named after the ID,
+// started instances can be renamed too. Their branch keeps its name.
 func (i *Instance) SetTitle(title string) error {
-	if i.started {
-		return fmt.Errorf("cannot change title of a started instance")
-	}
 	i.Title = title
 	return nil
 }
@@ -360,6 +547,11 @@ func (i *Instance) Paused() bool {
 	return i.Status == Paused
 }
 
+// Lost returns true if the tmux session or the worktree of the instance is gone.
+func (i *Instance) Lost() bool {
+	return i.Status == Lost
+}
+
 // TmuxAlive returns true if the tmux session is alive. This is a sanity check before attaching.
 func (i *Instance) TmuxAlive() bool {
 	return i.tmuxSession.DoesSessionExist()
@@ -373,6 +565,9 @@ func (i *Instance) Pause() error {
 	if i.Status == Paused {
 		return fmt.Errorf("instance is already paused")
 	}
+	if i.Status == Lost {
+		return fmt.Errorf("cannot pause lost instance %s, repair or kill it instead", i.Title)
+	}
 
 	var errs []error
 
@@ -464,6 +659,62 @@ func (i *Instance) Resume() error {
 	return nil
 }
 
+// RestartAgent repairs a lost instance whose worktree still exists by starting its program again in a new
+// tmux session. Whatever is left of the old session is closed first.
+func (i *Instance) RestartAgent() error {
+	if i.Status != Lost {
+		return fmt.Errorf("can only repair lost instances")
+	}
+	worktreePath := i.gitWorktree.GetWorktreePath()
+	if _, err := os.Stat(worktreePath); err != nil {
+		return fmt.Errorf("cannot restart agent: worktree %s is missing, recreate it from the branch instead",
+			worktreePath)
+	}
+	return i.restartSession()
+}
+
+// RecreateWorktree repairs a lost instance whose worktree is gone by checking its branch out into a new
+// worktree and starting its program there. Existing worktrees are never replaced, since they may hold
+// uncommitted changes.
+func (i *Instance) RecreateWorktree() error {
+	if i.Status != Lost {
+		return fmt.Errorf("can only repair lost instances")
+	}
+	worktreePath := i.gitWorktree.GetWorktreePath()
+	if _, err := os.Stat(worktreePath); err == nil {
+		return fmt.Errorf("cannot recreate worktree: %s still exists, restart the agent instead", worktreePath)
+	}
+
+	if checked, err := i.gitWorktree.IsBranchCheckedOut(); err != nil {
+		return fmt.Errorf("failed to check if branch is checked out: %w", err)
+	} else if checked {
+		return fmt.Errorf("cannot recreate worktree: branch is checked out, please switch to a different branch")
+	}
+	// Forget the missing worktree, otherwise git refuses to add it again.
+	if err := i.gitWorktree.Prune(); err != nil {
+		return fmt.Errorf("failed to prune git worktrees: %w", err)
+	}
+	if err := i.gitWorktree.SetupFromExistingBranch(); err != nil {
+		return err
+	}
+	return i.restartSession()
+}
+
+// restartSession replaces the tmux session of a lost instance with a new one running its program.
+func (i *Instance) restartSession() error {
+	if i.tmuxSession.DoesSessionExist() {
+		if err := i.tmuxSession.Close(); err != nil {
+			return fmt.Errorf("failed to close old tmux session: %w", err)
+		}
+	}
+	if err := i.tmuxSession.Start(i.gitWorktree.GetWorktreePath()); err != nil {
+		return fmt.Errorf("failed to start new session: %w", err)
+	}
+	i.LostReason = ""
+	i.SetStatus(Running)
+	return nil
+}
+
 // UpdateDiffStats updates the git diff statistics for this instance
 func (i *Instance) UpdateDiffStats() error {
 	if !i.started {
@@ -471,8 +722,8 @@ func (i *Instance) UpdateDiffStats() error {
 		return nil
 	}
 
-	if i.Status == Paused {
-		// Keep the previous diff stats if the instance is paused
+	if i.Status == Paused || i.Status == Lost {
+		// Keep the previous diff stats if the instance is paused or its worktree may be gone
 		return nil
 	}
 
@@ -495,6 +746,50 @@ func (i *Instance) GetDiffStats() *git.DiffStats {
 	return i.diffStats
 }
 
+// readyPollInterval matches the TUI's metadata tick, which is what decides between Running and Ready.
+const readyPollInterval = 500 * time.Millisecond
+
+// readyStablePolls is the number of consecutive polls without new output after which we consider the
+// program to be waiting for input.
+const readyStablePolls = 3
+
+// WaitUntilReady blocks until the program in the instance stops producing output, using the same
+// heuristic as the TUI. Prompts are accepted along the way if AutoYes is enabled.
+func (i *Instance) WaitUntilReady(timeout time.Duration) error {
+	if !i.started {
+		return fmt.Errorf("instance not started")
+	}
+	if i.Status == Paused {
+		return fmt.Errorf("instance %s is paused", i.Title)
+	}
+	if i.Status == Lost {
+		return fmt.Errorf("instance %s is lost: %s", i.Title, i.LostReason)
+	}
+
+	deadline := time.Now().Add(timeout)
+	stable := 0
+	for time.Now().Before(deadline) {
+		time.Sleep(readyPollInterval)
+		updated, hasPrompt := i.HasUpdated()
+		if updated {
+			i.SetStatus(Running)
+			stable = 0
+			continue
+		}
+		if hasPrompt && i.AutoYes {
+			i.TapEnter()
+			stable = 0
+			continue
+		}
+		stable++
+		if stable >= readyStablePolls {
+			i.SetStatus(Ready)
+			return nil
+		}
+	}
+	return fmt.Errorf("timed out after %s waiting for instance %s to become ready", timeout, i.Title)
+}
+
 // SendPrompt sends a prompt to the tmux session
 func (i *Instance) SendPrompt(prompt string) error {
 	if !i.started {
@@ -503,6 +798,9 @@ func (i *Instance) SendPrompt(prompt string) error {
 	if i.tmuxSession == nil {
 		return fmt.Errorf("tmux session not initialized")
 	}
+	if i.Status == Lost {
+		return fmt.Errorf("instance %s is lost: %s", i.Title, i.LostReason)
+	}
 	if err := i.tmuxSession.SendKeys(prompt); err != nil {
 		return fmt.Errorf("error sending keys to tmux session: %w", err)
 	}
@@ -2,13 +2,26 @@ package session
 
 import (
 	"claude-squad/config"
+	"claude-squad/log"
+	"claude-squad/session/git"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 )
 
+var (
+	// ErrInvalidTitle is returned when an instance can't be created because its title is invalid.
+	ErrInvalidTitle = errors.New("invalid title")
+	// ErrInstanceExists is returned when an instance can't be created because its title or branch is taken.
+	ErrInstanceExists = errors.New("instance already exists")
+	// ErrInstanceLimit is returned when an instance can't be created because GlobalInstanceLimit is reached.
+	ErrInstanceLimit = errors.New("instance limit reached")
+)
+
 // InstanceData represents the serializable data of an Instance
 type InstanceData struct {
+	ID        string    `json:"id"`
 	Title     string    `json:"title"`
 	Path      string    `json:"path"`
 	Branch    string    `json:"branch"`
@@ -18,10 +31,18 @@ type InstanceData struct {
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	AutoYes   bool      `json:"auto_yes"`
+	// LostReason explains why the instance is lost. See Lost.
+	LostReason string `json:"lost_reason,omitempty"`
 
 	Program   string          `json:"program"`
 	Worktree  GitWorktreeData `json:"worktree"`
 	DiffStats DiffStatsData   `json:"diff_stats"`
+	// Prompts are the prompts sent with Storage.SendPrompt. They are only kept in storage and end up in
+	// the archive when the instance is killed.
+	Prompts []PromptRecord `json:"prompts,omitempty"`
+	// ImportedScrollback is the scrollback an imported instance was exported with. Like Prompts, it is only
+	// kept in storage.
+	ImportedScrollback string `json:"imported_scrollback,omitempty"`
 }
 
 // GitWorktreeData represents the serializable data of a GitWorktree
@@ -33,6 +54,18 @@ type GitWorktreeData struct {
 	BaseCommitSHA string `json:"base_commit_sha"`
 }
 
+// GitWorktree returns the git worktree recorded for the instance. The worktree directory may not exist,
+// e.g. if the instance is paused.
+func (d InstanceData) GitWorktree() *git.GitWorktree {
+	return git.NewGitWorktreeFromStorage(
+		d.Worktree.RepoPath,
+		d.Worktree.WorktreePath,
+		d.Worktree.SessionName,
+		d.Worktree.BranchName,
+		d.Worktree.BaseCommitSHA,
+	)
+}
+
 // DiffStatsData represents the serializable data of a DiffStats
 type DiffStatsData struct {
 	Added   int    `json:"added"`
@@ -52,94 +85,333 @@ func NewStorage(state config.InstanceStorage) (*Storage, error) {
 	}, nil
 }
 
-// SaveInstances saves the list of instances to disk
-func (s *Storage) SaveInstances(instances []*Instance) error {
-	// Convert instances to InstanceData
-	data := make([]InstanceData, 0)
-	for _, instance := range instances {
-		if instance.Started() {
-			data = append(data, instance.ToInstanceData())
-		}
+// LoadStorage loads the state from disk and opens the instance storage selected in cfg.
+func LoadStorage(cfg *config.Config) (*Storage, error) {
+	state, err := config.LoadState()
+	if err != nil {
+		return nil, err
 	}
+	return OpenStorage(cfg, state)
+}
 
-	// Marshal to JSON
-	jsonData, err := json.Marshal(data)
+// OpenStorage opens the instance storage selected in cfg. The JSON storage keeps the instances in state.
+func OpenStorage(cfg *config.Config, state *config.State) (*Storage, error) {
+	instanceStorage, err := config.NewInstanceStorage(cfg, state)
 	if err != nil {
-		return fmt.Errorf("failed to marshal instances: %w", err)
+		return nil, fmt.Errorf("failed to open instance storage: %w", err)
 	}
+	return NewStorage(instanceStorage)
+}
+
+// SaveInstances stores what watching the given instances found out: whether they are running or ready, and
+// their diff stats. Everything else is stored by the process which changes it as soon as it does, so the other
+// fields of the stored records are left alone. Otherwise a stale copy would revert e.g. a pause or a rename
+// done by another process. Instances which aren't stored, or not running or ready, are skipped.
+func (s *Storage) SaveInstances(instances []*Instance) error {
+	return s.updateInstanceData(func(instancesData []InstanceData) ([]InstanceData, error) {
+		updated := make(map[string]InstanceData, len(instances))
+		for _, instance := range instances {
+			if instance.Started() {
+				updated[instance.ID] = instance.ToInstanceData()
+			}
+		}
+		for i, existing := range instancesData {
+			data, ok := updated[existing.ID]
+			if !ok || !isActive(existing.Status) || !isActive(data.Status) {
+				continue
+			}
+			instancesData[i].Status = data.Status
+			instancesData[i].DiffStats = data.DiffStats
+		}
+		return instancesData, nil
+	})
+}
 
-	return s.state.SaveInstances(jsonData)
+// isActive returns whether an instance with the given status is running or ready, which is the only
+// difference SaveInstances stores.
+func isActive(status Status) bool {
+	return status == Running || status == Ready
 }
 
-// LoadInstances loads the list of instances from disk
-func (s *Storage) LoadInstances() ([]*Instance, error) {
-	jsonData := s.state.GetInstances()
+// LoadInstanceData decodes the stored instances without restoring them. Unlike LoadInstances, this
+// has no side effects on the underlying tmux sessions, so it is safe for read-only queries.
+func (s *Storage) LoadInstanceData() ([]InstanceData, error) {
+	return decodeInstanceData(s.state.GetInstances())
+}
 
+// decodeInstanceData unmarshals stored instances.
+func decodeInstanceData(instancesJSON json.RawMessage) ([]InstanceData, error) {
 	var instancesData []InstanceData
-	if err := json.Unmarshal(jsonData, &instancesData); err != nil {
+	if err := json.Unmarshal(instancesJSON, &instancesData); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal instances: %w", err)
 	}
+	return instancesData, nil
+}
 
-	instances := make([]*Instance, len(instancesData))
-	for i, data := range instancesData {
-		instance, err := FromInstanceData(data)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create instance %s: %w", data.Title, err)
+// AddInstance appends a started instance to storage without touching the instances which are
+// already stored.
+func (s *Storage) AddInstance(instance *Instance) error {
+	if !instance.Started() {
+		return fmt.Errorf("cannot store instance %s that has not been started", instance.Title)
+	}
+
+	return s.addInstanceData(instance.ToInstanceData())
+}
+
+// addInstanceData appends an instance to storage. IDs and titles must be unique, and the instance limit
+// is checked again, since another process may have added instances after CheckNewInstance.
+func (s *Storage) addInstanceData(data InstanceData) error {
+	return s.updateInstanceData(func(instancesData []InstanceData) ([]InstanceData, error) {
+		if len(instancesData) >= GlobalInstanceLimit {
+			return nil, fmt.Errorf("%w: you can't create more than %d instances", ErrInstanceLimit, GlobalInstanceLimit)
 		}
-		instances[i] = instance
+		for _, existing := range instancesData {
+			if existing.ID == data.ID {
+				return nil, fmt.Errorf("instance ID already exists: %s", data.ID)
+			}
+			if existing.Title == data.Title {
+				return nil, fmt.Errorf("%w: %s", ErrInstanceExists, data.Title)
+			}
+		}
+		return append(instancesData, data), nil
+	})
+}
+
+// CreateInstance starts a new instance and adds it to storage, enforcing the same limits as the TUI. The
+// instance is killed again if it can't be stored.
+func (s *Storage) CreateInstance(opts InstanceOptions) (*Instance, error) {
+	if err := s.CheckNewInstance(opts.Title, opts.Path); err != nil {
+		return nil, err
 	}
 
-	return instances, nil
+	instance, err := NewInstance(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := instance.Start(true); err != nil {
+		return nil, err
+	}
+	if err := s.AddInstance(instance); err != nil {
+		if killErr := instance.Kill(); killErr != nil {
+			err = fmt.Errorf("%v (cleanup error: %v)", err, killErr)
+		}
+		return nil, err
+	}
+	return instance, nil
 }
 
-// DeleteInstance removes an instance from storage
-func (s *Storage) DeleteInstance(title string) error {
-	instances, err := s.LoadInstances()
+// KillInstance archives an instance, removes it from storage and kills it. Instances whose branch is
+// checked out in the repository are refused. The instance is not killed if it can't be archived.
+func (s *Storage) KillInstance(instance *Instance) error {
+	worktree, err := instance.GetGitWorktree()
 	if err != nil {
-		return fmt.Errorf("failed to load instances: %w", err)
+		return err
+	}
+	checkedOut, err := worktree.IsBranchCheckedOut()
+	if err != nil {
+		return err
+	}
+	if checkedOut {
+		return fmt.Errorf("instance %s is currently checked out", instance.Title)
 	}
 
-	found := false
-	newInstances := make([]*Instance, 0)
-	for _, instance := range instances {
-		data := instance.ToInstanceData()
-		if data.Title != title {
-			newInstances = append(newInstances, instance)
-		} else {
-			found = true
+	instancesData, err := s.LoadInstanceData()
+	if err != nil {
+		return err
+	}
+	var stored InstanceData
+	for _, data := range instancesData {
+		if data.ID == instance.ID {
+			stored = data
 		}
 	}
+	if err := SaveArchiveEntry(newArchiveEntry(instance, stored)); err != nil {
+		return fmt.Errorf("failed to archive instance %s: %w", instance.Title, err)
+	}
 
-	if !found {
-		return fmt.Errorf("instance not found: %s", title)
+	// Delete from storage first, so a failed cleanup doesn't leave a record behind.
+	if err := s.DeleteInstance(instance.ID); err != nil {
+		return err
 	}
+	return instance.Kill()
+}
 
-	return s.SaveInstances(newInstances)
+// CheckNewInstance returns an error if an instance with the given title can't be created in the repository
+// at repoPath: the title is invalid or taken, the instance limit is reached, or the branch the instance would
+// get belongs to another instance, which can happen after renaming.
+func (s *Storage) CheckNewInstance(title string, repoPath string) error {
+	return s.checkNewInstance(title, git.BranchName(repoPath, title))
 }
 
-// UpdateInstance updates an existing instance in storage
-func (s *Storage) UpdateInstance(instance *Instance) error {
-	instances, err := s.LoadInstances()
+// checkNewInstance is CheckNewInstance for an instance which gets the given branch.
+func (s *Storage) checkNewInstance(title string, branch string) error {
+	if err := validateTitle(title); err != nil {
+		return err
+	}
+	existing, err := s.LoadInstanceData()
+	if err != nil {
+		return err
+	}
+	if len(existing) >= GlobalInstanceLimit {
+		return fmt.Errorf("%w: you can't create more than %d instances", ErrInstanceLimit, GlobalInstanceLimit)
+	}
+	for _, data := range existing {
+		if data.Title == title {
+			return fmt.Errorf("%w: %s", ErrInstanceExists, title)
+		}
+		if data.Branch == branch {
+			return fmt.Errorf("%w: branch %s belongs to instance %s", ErrInstanceExists, branch, data.Title)
+		}
+	}
+	return nil
+}
+
+// validateTitle checks a title against the same limits as the TUI.
+func validateTitle(title string) error {
+	if title == "" {
+		return fmt.Errorf("%w: cannot be empty", ErrInvalidTitle)
+	}
+	if len(title) > 32 {
+		return fmt.Errorf("%w: cannot be longer than 32 characters", ErrInvalidTitle)
+	}
+	return nil
+}
+
+// LoadInstances loads the list of instances from disk. Each instance is restored on its own, so instances
+// which can't be restored don't prevent the others from loading. They are marked as lost instead.
+func (s *Storage) LoadInstances() ([]*Instance, error) {
+	instancesData, err := s.LoadInstanceData()
+	if err != nil {
+		return nil, err
+	}
+
+	instances := make([]*Instance, len(instancesData))
+	for i, data := range instancesData {
+		instances[i] = s.RestoreInstance(data)
+	}
+
+	return instances, nil
+}
+
+// RestoreInstance restores a stored instance with FromInstanceData. If the instance turned out to be lost,
+// or a lost instance turned out to be fine again, its stored status is updated so other processes see it.
+func (s *Storage) RestoreInstance(data InstanceData) *Instance {
+	instance := FromInstanceData(data)
+	if instance.Status == data.Status && instance.LostReason == data.LostReason {
+		return instance
+	}
+	if data.Status != Lost && !instance.Lost() {
+		// Only the difference between running and ready, which isn't worth a write.
+		return instance
+	}
+
+	if instance.Lost() {
+		log.WarningLog.Printf("instance %s is lost: %s", instance.Title, instance.LostReason)
+	}
+	err := s.updateInstanceRecord(instance.ID, func(data *InstanceData) {
+		data.Status = instance.Status
+		data.LostReason = instance.LostReason
+	})
 	if err != nil {
-		return fmt.Errorf("failed to load instances: %w", err)
+		log.ErrorLog.Printf("failed to store status of instance %s: %v", instance.Title, err)
 	}
+	return instance
+}
 
+// DeleteInstance removes the instance with the given ID from storage
+func (s *Storage) DeleteInstance(id string) error {
+	return s.state.DeleteInstance(id)
+}
+
+// UpdateInstance updates an existing instance in storage. The other stored instances are left as they
+// are, so they don't need to be restored.
+func (s *Storage) UpdateInstance(instance *Instance) error {
 	data := instance.ToInstanceData()
-	found := false
-	for i, existing := range instances {
-		existingData := existing.ToInstanceData()
-		if existingData.Title == data.Title {
-			instances[i] = instance
-			found = true
-			break
-		}
+	return s.updateInstanceRecord(data.ID, func(existing *InstanceData) {
+		data.Prompts = existing.Prompts
+		data.ImportedScrollback = existing.ImportedScrollback
+		*existing = data
+	})
+}
+
+// SendPrompt sends a prompt to an instance and records it, so it can be archived when the instance is
+// killed.
+func (s *Storage) SendPrompt(instance *Instance, prompt string) error {
+	if err := instance.SendPrompt(prompt); err != nil {
+		return err
+	}
+	record := PromptRecord{Time: time.Now(), Text: prompt}
+	err := s.updateInstanceRecord(instance.ID, func(data *InstanceData) {
+		data.Prompts = append(data.Prompts, record)
+	})
+	if err != nil {
+		// The prompt was sent, so don't report a failure.
+		log.ErrorLog.Printf("failed to record prompt of instance %s: %v", instance.Title, err)
 	}
+	return nil
+}
 
-	if !found {
-		return fmt.Errorf("instance not found: %s", data.Title)
+// RenameInstance changes the title of the stored instance with the given ID. Titles must be unique.
+func (s *Storage) RenameInstance(id string, title string) error {
+	if err := validateTitle(title); err != nil {
+		return err
 	}
+	return s.updateInstanceData(func(instancesData []InstanceData) ([]InstanceData, error) {
+		idx := -1
+		for i, data := range instancesData {
+			if data.ID == id {
+				idx = i
+			} else if data.Title == title {
+				return nil, fmt.Errorf("instance already exists: %s", title)
+			}
+		}
+		if idx == -1 {
+			return nil, fmt.Errorf("instance not found: %s", id)
+		}
+		instancesData[idx].Title = title
+		instancesData[idx].UpdatedAt = time.Now()
+		return instancesData, nil
+	})
+}
 
-	return s.SaveInstances(instances)
+// updateInstanceData applies update to the latest stored instances and saves the result. Other
+// processes can't modify the stored instances in between.
+func (s *Storage) updateInstanceData(update func(instancesData []InstanceData) ([]InstanceData, error)) error {
+	return s.state.UpdateInstances(func(instancesJSON json.RawMessage) (json.RawMessage, error) {
+		instancesData, err := decodeInstanceData(instancesJSON)
+		if err != nil {
+			return nil, err
+		}
+		instancesData, err = update(instancesData)
+		if err != nil {
+			return nil, err
+		}
+		if instancesData == nil {
+			instancesData = []InstanceData{}
+		}
+		jsonData, err := json.Marshal(instancesData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal instances: %w", err)
+		}
+		return jsonData, nil
+	})
+}
+
+// updateInstanceRecord applies update to the latest stored data of the instance with the given ID and saves
+// the result. Unlike updateInstanceData, the other instances are neither decoded nor written.
+func (s *Storage) updateInstanceRecord(id string, update func(data *InstanceData)) error {
+	return s.state.UpdateInstance(id, func(instanceJSON json.RawMessage) (json.RawMessage, error) {
+		var data InstanceData
+		if err := json.Unmarshal(instanceJSON, &data); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal instance: %w", err)
+		}
+		update(&data)
+		jsonData, err := json.Marshal(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal instance: %w", err)
+		}
+		return jsonData, nil
+	})
 }
 
 // DeleteAllInstances removes all stored instances
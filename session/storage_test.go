@@ -0,0 +1,89 @@
+package session
+
+import (
+	"claude-squad/config"
+	"claude-squad/session/git"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewInstanceID(t *testing.T) {
+	a, err := newInstanceID()
+	require.NoError(t, err)
+	b, err := newInstanceID()
+	require.NoError(t, err)
+	assert.Len(t, a, 12)
+	assert.NotEqual(t, a, b)
+}
+
+func TestFromInstanceDataMarksMissingResourcesLost(t *testing.T) {
+	// Looking up the tmux session reads the config.
+	t.Setenv("HOME", t.TempDir())
+	worktreePath := filepath.Join(t.TempDir(), "gone")
+	instance := FromInstanceData(InstanceData{
+		ID:     "0123456789ab",
+		Title:  "lost",
+		Status: Running,
+		Worktree: GitWorktreeData{
+			RepoPath:     t.TempDir(),
+			WorktreePath: worktreePath,
+			BranchName:   "lost",
+		},
+	})
+
+	assert.True(t, instance.Started())
+	assert.True(t, instance.Lost())
+	assert.Contains(t, instance.LostReason, "worktree "+worktreePath+" is missing")
+	assert.Contains(t, instance.LostReason, "tmux session is gone")
+	assert.Equal(t, Lost, instance.ToInstanceData().Status)
+	assert.Equal(t, instance.LostReason, instance.ToInstanceData().LostReason)
+
+	// Lost instances can't take input, and pausing them is refused instead of failing halfway.
+	assert.Error(t, instance.SendPrompt("hello"))
+	assert.Error(t, instance.Pause())
+	assert.Error(t, instance.RecreateWorktree())
+	assert.Error(t, instance.RestartAgent())
+}
+
+func TestSaveInstancesKeepsChangesOfOtherProcesses(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	state, err := config.LoadState()
+	require.NoError(t, err)
+	storage, err := NewStorage(state)
+	require.NoError(t, err)
+	require.NoError(t, storage.addInstanceData(InstanceData{ID: "paused", Title: "renamed", Status: Paused}))
+	require.NoError(t, storage.addInstanceData(InstanceData{ID: "running", Title: "running", Status: Running}))
+
+	// The copies of a process which didn't see the pause and the rename.
+	instances := []*Instance{
+		{ID: "paused", Title: "paused", Status: Running, started: true},
+		{ID: "running", Title: "stale", Status: Ready, started: true, diffStats: &git.DiffStats{Added: 3}},
+	}
+	require.NoError(t, storage.SaveInstances(instances))
+
+	instancesData, err := storage.LoadInstanceData()
+	require.NoError(t, err)
+	require.Len(t, instancesData, 2)
+	assert.Equal(t, "renamed", instancesData[0].Title)
+	assert.Equal(t, Paused, instancesData[0].Status)
+	assert.Equal(t, "running", instancesData[1].Title)
+	assert.Equal(t, Ready, instancesData[1].Status)
+	assert.Equal(t, 3, instancesData[1].DiffStats.Added)
+}
+
+func TestAddInstanceDataChecksLimit(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	state, err := config.LoadState()
+	require.NoError(t, err)
+	storage, err := NewStorage(state)
+	require.NoError(t, err)
+	for i := 0; i < GlobalInstanceLimit; i++ {
+		require.NoError(t, storage.addInstanceData(InstanceData{ID: fmt.Sprint(i), Title: fmt.Sprint(i)}))
+	}
+	assert.ErrorContains(t, storage.addInstanceData(InstanceData{ID: "extra", Title: "extra"}),
+		"you can't create more than")
+}
@@ -0,0 +1,145 @@
+package tmux
+
+import (
+	"claude-squad/config"
+	"claude-squad/log"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrWindowNotRunning is returned for companion windows which aren't running, because they were never started
+// or their command exited. Attaching to them starts them again.
+var ErrWindowNotRunning = errors.New("window is not running")
+
+// Companions returns the names of the companion windows of the session, in the order of the config.
+func (t *TmuxSession) Companions() []string {
+	names := make([]string, 0, len(t.companions))
+	for _, companion := range t.companions {
+		names = append(names, companion.Name)
+	}
+	return names
+}
+
+// startCompanions starts the companion windows of a new session. Companions which fail to start are only
+// logged, attaching to them tries again.
+func (t *TmuxSession) startCompanions() {
+	for _, companion := range t.companions {
+		if err := t.startCompanion(companion); err != nil {
+			log.ErrorLog.Printf("could not start companion %s of session %s: %v", companion.Name, t.sanitizedName, err)
+		}
+	}
+}
+
+// startCompanion starts a companion window in the directory the session was started in, the worktree.
+func (t *TmuxSession) startCompanion(companion config.Companion) error {
+	args := []string{"new-window", "-d", "-t", t.sessionTarget(), "-n", companion.Name, "-c", "#{session_path}"}
+	if companion.Command != "" {
+		args = append(args, companion.Command)
+	}
+	if err := t.cmdExec.Run(t.command(args...)); err != nil {
+		return fmt.Errorf("error starting window %s: %w", companion.Name, err)
+	}
+	return nil
+}
+
+// companion returns the companion named name.
+func (t *TmuxSession) companion(name string) (config.Companion, error) {
+	for _, companion := range t.companions {
+		if companion.Name == name {
+			return companion, nil
+		}
+	}
+	return config.Companion{}, fmt.Errorf("no companion named %q, configured companions: %s", name,
+		strings.Join(t.Companions(), ", "))
+}
+
+// hasWindow returns true if the session has a window named name.
+func (t *TmuxSession) hasWindow(name string) bool {
+	output, err := t.cmdExec.Output(t.command("list-windows", "-t", t.sessionTarget(), "-F", "#{window_name}"))
+	if err != nil {
+		return false
+	}
+	for _, window := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if window == name {
+			return true
+		}
+	}
+	return false
+}
+
+// CaptureWindow returns the content of a window like Preview does for the window of the program, which an
+// empty name or config.AgentWindowName selects. Companions which aren't running return ErrWindowNotRunning.
+func (t *TmuxSession) CaptureWindow(name string) (string, error) {
+	if name == "" || name == config.AgentWindowName {
+		return t.Preview()
+	}
+	output, err := t.cmdExec.Output(t.command("capture-pane", "-p", "-e", "-J", "-t", t.windowTarget(name)))
+	if err != nil {
+		if !t.hasWindow(name) {
+			return "", ErrWindowNotRunning
+		}
+		return "", fmt.Errorf("error capturing window %s: %v", name, err)
+	}
+	return string(output), nil
+}
+
+// CaptureWindowScrollback is like CaptureWindow, but includes the history of the window.
+func (t *TmuxSession) CaptureWindowScrollback(name string) (string, error) {
+	if name == "" || name == config.AgentWindowName {
+		return t.PreviewScrollback()
+	}
+	output, err := t.cmdExec.Output(t.command("capture-pane", "-p", "-e", "-J", "-S", "-", "-E", "-", "-t",
+		t.windowTarget(name)))
+	if err != nil {
+		if !t.hasWindow(name) {
+			return "", ErrWindowNotRunning
+		}
+		return "", fmt.Errorf("error capturing window %s: %v", name, err)
+	}
+	return string(output), nil
+}
+
+// AttachWindow attaches to the session like Attach, showing a window. An empty name or config.AgentWindowName
+// selects the window of the program. Companions which aren't running are started first. Detaching shows the
+// window of the program again, since keys are sent to the window shown.
+func (t *TmuxSession) AttachWindow(name string) (chan struct{}, error) {
+	if name != "" && name != config.AgentWindowName {
+		companion, err := t.companion(name)
+		if err != nil {
+			return nil, err
+		}
+		if !t.hasWindow(name) {
+			if err := t.startCompanion(companion); err != nil {
+				return nil, err
+			}
+		}
+		if err := t.cmdExec.Run(t.command("select-window", "-t", t.windowTarget(name))); err != nil {
+			return nil, fmt.Errorf("error selecting window %s: %w", name, err)
+		}
+	}
+	return t.Attach()
+}
+
+// selectAgentWindow shows the window of the program again.
+func (t *TmuxSession) selectAgentWindow() {
+	if err := t.cmdExec.Run(t.command("select-window", "-t", t.agentTarget())); err != nil {
+		log.ErrorLog.Printf("error selecting the window of the program in %s: %v", t.sanitizedName, err)
+	}
+}
+
+// sessionTarget addresses the session in tmux commands.
+func (t *TmuxSession) sessionTarget() string {
+	return fmt.Sprintf("=%s:", t.sanitizedName)
+}
+
+// agentTarget addresses the window of the program, the first one of the session. Sessions created before
+// the window was named don't have a name to go by.
+func (t *TmuxSession) agentTarget() string {
+	return fmt.Sprintf("=%s:^", t.sanitizedName)
+}
+
+// windowTarget addresses a companion window.
+func (t *TmuxSession) windowTarget(name string) string {
+	return fmt.Sprintf("=%s:%s", t.sanitizedName, name)
+}
@@ -0,0 +1,303 @@
+package tmux
+
+import (
+	"bufio"
+	"claude-squad/cmd"
+	"claude-squad/log"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MonitorSessionPrefix prefixes the names of the sessions control mode clients are attached to. It doesn't
+// start with TmuxPrefix, so CleanupSessions leaves them alone; they go away with their client.
+const MonitorSessionPrefix = "claudesquad-monitor-"
+
+// controlRetryInterval is how long to wait before starting a control mode client again after it failed.
+const controlRetryInterval = 10 * time.Second
+
+// orphanCheckDelay is how long to wait after sessions changed before looking for windows left behind.
+const orphanCheckDelay = 200 * time.Millisecond
+
+// controlClient is a tmux control mode client (tmux -C) which counts the %output notifications of the panes
+// of the sessions it watches. Monitors only capture a pane after it printed something, instead of capturing
+// every pane on every tick.
+//
+// Control mode clients only get the output of the panes in the session they are attached to. So the client
+// is attached to a monitor session of its own, and the window of each watched session is linked into it.
+// Linking a window shares it rather than copying it, and control mode clients don't affect the window size.
+type controlClient struct {
+	cmdExec cmd.Executor
+	// session is the name of the monitor session.
+	session string
+	// stdin keeps the client running. It exits when stdin is closed, which happens when this process exits.
+	stdin io.WriteCloser
+
+	// watchMu serializes watching new sessions, so their windows are linked once.
+	watchMu sync.Mutex
+	mu      sync.Mutex
+	// placeholder is the window the monitor session was created with, empty until it is known.
+	placeholder string
+	// watched maps the names of the watched sessions to their pane.
+	watched map[string]watchedPane
+	// outputs counts the %output notifications of each watched pane by pane ID.
+	outputs map[string]uint64
+	// done is closed when the client exits.
+	done chan struct{}
+}
+
+type watchedPane struct {
+	windowID string
+	paneID   string
+}
+
+var sharedControl struct {
+	sync.Mutex
+	client   *controlClient
+	failedAt time.Time
+}
+
+// sharedControlClient returns the control mode client of this process, starting it if needed. It returns nil
+// if the client can't be started, in which case callers fall back to capturing the pane.
+func sharedControlClient(cmdExec cmd.Executor) *controlClient {
+	sharedControl.Lock()
+	defer sharedControl.Unlock()
+
+	if c := sharedControl.client; c != nil {
+		select {
+		case <-c.done:
+			sharedControl.client = nil
+		default:
+			return c
+		}
+	}
+	if time.Since(sharedControl.failedAt) < controlRetryInterval {
+		return nil
+	}
+	c, err := startControlClient(cmdExec)
+	if err != nil {
+		log.WarningLog.Printf("tmux control mode is unavailable, falling back to capturing panes: %v", err)
+		sharedControl.failedAt = time.Now()
+		return nil
+	}
+	sharedControl.client = c
+	return c
+}
+
+// runningControlClient returns the control mode client of this process if it is running, without starting it.
+func runningControlClient() *controlClient {
+	sharedControl.Lock()
+	defer sharedControl.Unlock()
+	return sharedControl.client
+}
+
+// startControlClient creates the monitor session of this process and attaches a control mode client to it.
+// The monitor session is destroyed as soon as the client exits, which unlinks the watched windows again.
+func startControlClient(cmdExec cmd.Executor) (*controlClient, error) {
+	c := &controlClient{
+		cmdExec: cmdExec,
+		session: fmt.Sprintf("%s%d", MonitorSessionPrefix, os.Getpid()),
+		watched: make(map[string]watchedPane),
+		outputs: make(map[string]uint64),
+		done:    make(chan struct{}),
+	}
+
+	// The placeholder window just has to exist until the client exits, cat does that without using the CPU.
+	command := serverCommand("-C", "new-session", "-s", c.session, "cat",
+		";", "set-option", "destroy-unattached", "on")
+	var err error
+	if c.stdin, err = command.StdinPipe(); err != nil {
+		return nil, err
+	}
+	stdout, err := command.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := command.Start(); err != nil {
+		return nil, fmt.Errorf("error starting tmux control mode client: %w", err)
+	}
+	go func() {
+		c.read(stdout)
+		_ = command.Wait()
+	}()
+
+	timeout := time.After(2 * time.Second)
+	for {
+		output, err := cmdExec.Output(serverCommand("display-message", "-p", "-t",
+			fmt.Sprintf("=%s:", c.session), "#{window_id}"))
+		if err == nil {
+			c.mu.Lock()
+			c.placeholder = strings.TrimSpace(string(output))
+			c.mu.Unlock()
+			return c, nil
+		}
+		select {
+		case <-c.done:
+			return nil, fmt.Errorf("tmux control mode client exited")
+		case <-timeout:
+			_ = command.Process.Kill()
+			return nil, fmt.Errorf("timed out waiting for tmux monitor session %s", c.session)
+		default:
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+// read handles the notifications of the client until it exits.
+func (c *controlClient) read(stdout io.Reader) {
+	defer close(c.done)
+
+	r := bufio.NewReader(stdout)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if err != io.EOF {
+				log.ErrorLog.Printf("error reading from tmux control mode client: %v", err)
+			}
+			log.WarningLog.Printf("tmux control mode client exited")
+			return
+		}
+		name, args := parseNotification(strings.TrimSuffix(line, "\n"))
+		switch name {
+		case "%output":
+			paneID, _, _ := strings.Cut(args, " ")
+			c.mu.Lock()
+			if _, ok := c.outputs[paneID]; ok {
+				c.outputs[paneID]++
+			}
+			c.mu.Unlock()
+		case "%sessions-changed":
+			// Sessions killed while their window is linked into the monitor session leave the window behind.
+			// tmux notifies before it unlinks the windows of the killed session, so check a bit later.
+			time.AfterFunc(orphanCheckDelay, c.killOrphanedWindows)
+		}
+	}
+}
+
+// parseNotification splits a line of control mode output into the notification name and its arguments.
+// Lines which aren't notifications, like the output of commands, have an empty name.
+func parseNotification(line string) (name string, args string) {
+	if !strings.HasPrefix(line, "%") {
+		return "", ""
+	}
+	name, args, _ = strings.Cut(line, " ")
+	return name, args
+}
+
+// outputCount returns the number of times the pane of a session printed something since the session was
+// first watched. The session is watched from the first call on.
+func (c *controlClient) outputCount(sessionName string) (uint64, error) {
+	if count, ok := c.watchedOutputCount(sessionName); ok {
+		return count, nil
+	}
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+	if count, ok := c.watchedOutputCount(sessionName); ok {
+		return count, nil
+	}
+
+	// Only the window of the program is watched, it is the first one.
+	target := fmt.Sprintf("=%s:^", sessionName)
+	output, err := c.cmdExec.Output(serverCommand("display-message", "-p", "-t", target,
+		"#{window_id} #{pane_id}"))
+	if err != nil {
+		return 0, fmt.Errorf("error finding pane of session %s: %w", sessionName, err)
+	}
+	windowID, paneID, _ := strings.Cut(strings.TrimSpace(string(output)), " ")
+
+	// Register the pane before linking it, so no output is missed.
+	c.mu.Lock()
+	c.watched[sessionName] = watchedPane{windowID: windowID, paneID: paneID}
+	c.outputs[paneID] = 0
+	c.mu.Unlock()
+
+	link := serverCommand("link-window", "-d", "-s", target, "-t", fmt.Sprintf("=%s:", c.session))
+	if err := c.cmdExec.Run(link); err != nil {
+		c.forget(sessionName)
+		return 0, fmt.Errorf("error linking window of session %s into %s: %w", sessionName, c.session, err)
+	}
+	return 0, nil
+}
+
+func (c *controlClient) watchedOutputCount(sessionName string) (uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pane, ok := c.watched[sessionName]
+	if !ok {
+		return 0, false
+	}
+	return c.outputs[pane.paneID], true
+}
+
+// unwatch unlinks the window of a session from the monitor session, so killing the session kills the window.
+func (c *controlClient) unwatch(sessionName string) {
+	pane, ok := c.forget(sessionName)
+	if !ok {
+		return
+	}
+	unlink := serverCommand("unlink-window", "-t", fmt.Sprintf("=%s:%s", c.session, pane.windowID))
+	if err := c.cmdExec.Run(unlink); err != nil {
+		log.WarningLog.Printf("error unlinking window of session %s: %v", sessionName, err)
+	}
+}
+
+func (c *controlClient) forget(sessionName string) (watchedPane, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pane, ok := c.watched[sessionName]
+	if ok {
+		delete(c.watched, sessionName)
+		delete(c.outputs, pane.paneID)
+	}
+	return pane, ok
+}
+
+// killOrphanedWindows kills the windows which are only linked into monitor sessions anymore, because their
+// session was killed by another process.
+func (c *controlClient) killOrphanedWindows() {
+	output, err := c.cmdExec.Output(serverCommand("list-windows", "-t", fmt.Sprintf("=%s:", c.session),
+		"-F", "#{window_id} #{window_linked_sessions_list}"))
+	if err != nil {
+		// The monitor session is gone along with the client.
+		return
+	}
+	c.mu.Lock()
+	placeholder := c.placeholder
+	c.mu.Unlock()
+	if placeholder == "" {
+		// The client is still starting, so nothing was linked yet.
+		return
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		windowID, sessions, _ := strings.Cut(line, " ")
+		if windowID == placeholder || windowID == "" {
+			continue
+		}
+		orphaned := true
+		for _, session := range strings.Split(sessions, ",") {
+			if !strings.HasPrefix(session, MonitorSessionPrefix) {
+				orphaned = false
+				break
+			}
+		}
+		if !orphaned {
+			continue
+		}
+
+		c.mu.Lock()
+		for name, pane := range c.watched {
+			if pane.windowID == windowID {
+				delete(c.watched, name)
+				delete(c.outputs, pane.paneID)
+			}
+		}
+		c.mu.Unlock()
+		if err := c.cmdExec.Run(serverCommand("kill-window", "-t", windowID)); err != nil {
+			// Another monitor may have killed it first.
+			log.InfoLog.Printf("error killing orphaned window %s: %v", windowID, err)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package tmux
+
+import "slices"
+
+// PaneFollower finds the lines of a pane which weren't returned yet, to follow its output like tail -f. Lines
+// are counted from the first line the pane ever had, so each line is returned once, even after tmux dropped
+// the oldest lines of the history to stay within its limit.
+type PaneFollower struct {
+	// lines is the last capture and history the number of its lines which were in the history. first is the
+	// number of its first line.
+	lines   []string
+	history int
+	first   int
+	// returned is the number of the first line which wasn't returned yet.
+	returned int
+}
+
+// Next takes a capture of the whole pane split into lines, of which the first history lines are in the history
+// and the cursor is on the visible screen row cursorY. It returns the lines which weren't returned before. The
+// line of the cursor and the ones below it may still change, e.g. while the program prints a line piece by
+// piece, so they are only returned once the cursor left them.
+func (f *PaneFollower) Next(lines []string, history int, cursorY int) []string {
+	history = min(history, len(lines))
+	// The lines in the history don't change, so they show up again, except for the ones tmux dropped from
+	// the top. tmux never drops all of them, so if none are left, the history was cleared and everything is new.
+	dropped := -1
+	if f.history == 0 {
+		dropped = 0
+	}
+	for n := 0; n < f.history; n++ {
+		kept := f.history - n
+		if kept <= len(lines) && slices.Equal(f.lines[n:f.history], lines[:kept]) {
+			dropped = n
+			break
+		}
+	}
+	if dropped == -1 {
+		f.first = f.returned
+	} else {
+		f.first += dropped
+	}
+	f.lines, f.history = lines, history
+
+	done := min(history+cursorY, len(lines))
+	from := max(f.returned-f.first, 0)
+	if from >= done {
+		return nil
+	}
+	f.returned = f.first + done
+	return lines[from:done]
+}
@@ -0,0 +1,95 @@
+package tmux
+
+import (
+	"claude-squad/config"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// RecordingsDirName is the directory in the config directory which holds the recordings of the sessions.
+const RecordingsDirName = "recordings"
+
+// RecordCommand is the hidden command of claude-squad which writes what it reads to a recording, see
+// RecordingCommand.
+const RecordCommand = "record"
+
+// RecordingPath returns the path of the asciicast recording of the session of the instance with the given ID.
+// Recordings are kept after the instance is killed.
+func RecordingPath(id string) (string, error) {
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get config directory: %w", err)
+	}
+	return filepath.Join(configDir, RecordingsDirName, id+".cast"), nil
+}
+
+// RecordingCommand returns the shell command tmux pipes the output of a pane into to record it at path. tmux
+// expands the size of the pane in it, along with the server socket and pane ID, which the recorder looks up
+// the size with when the pane is resized. See PaneSize.
+func RecordingCommand(path string) (string, error) {
+	execPath, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to get executable path: %w", err)
+	}
+	return fmt.Sprintf("exec %s %s --width '#{pane_width}' --height '#{pane_height}' "+
+		"--socket '#{socket_path}' --pane '#{pane_id}' %s", shellQuote(execPath), RecordCommand, shellQuote(path)), nil
+}
+
+// PaneSize returns the width and height of the pane with the given ID on the tmux server listening on socket.
+func PaneSize(socket string, pane string) (width int, height int, err error) {
+	args := append(SocketArgs(socket), "display-message", "-p", "-t", pane, "#{pane_width} #{pane_height}")
+	output, err := exec.Command("tmux", args...).Output()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get the size of pane %s: %w", pane, err)
+	}
+	if _, err := fmt.Sscanf(string(output), "%d %d", &width, &height); err != nil {
+		return 0, 0, fmt.Errorf("failed to parse the size of pane %s %q: %w", pane, output, err)
+	}
+	return width, height, nil
+}
+
+// startRecording pipes the output of the program into a recording, unless it already is. It only records
+// from now on, what the program printed before is lost.
+func (t *TmuxSession) startRecording() error {
+	// pipe-pane would replace an open pipe, and -o closes it.
+	output, err := t.cmdExec.Output(t.command("display-message", "-p", "-t", t.agentTarget(), "#{pane_pipe}"))
+	if err != nil {
+		return fmt.Errorf("error checking the pipe of the pane: %w", err)
+	}
+	if strings.TrimSpace(string(output)) == "1" {
+		return nil
+	}
+	args, err := t.recordingArgs()
+	if err != nil {
+		return err
+	}
+	if err := t.cmdExec.Run(t.command(args...)); err != nil {
+		return fmt.Errorf("error piping the pane: %w", err)
+	}
+	return nil
+}
+
+// recordingArgs returns the tmux command which pipes the output of the program into its recording.
+func (t *TmuxSession) recordingArgs() ([]string, error) {
+	// Sessions are named after the IDs of their instances.
+	path, err := RecordingPath(strings.TrimPrefix(t.sanitizedName, TmuxPrefix))
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create recordings directory: %w", err)
+	}
+	command, err := RecordingCommand(path)
+	if err != nil {
+		return nil, err
+	}
+	return []string{"pipe-pane", "-t", t.agentTarget(), command}, nil
+}
+
+// shellQuote quotes s for sh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
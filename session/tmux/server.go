@@ -0,0 +1,70 @@
+package tmux
+
+import (
+	"bytes"
+	"claude-squad/config"
+	"claude-squad/log"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ServerConfigFileName is the tmux config file claude-squad starts its tmux server with. It lives in the config
+// directory and is rewritten on every start.
+const ServerConfigFileName = "tmux.conf"
+
+// serverConfig keeps the server minimal, so the sessions behave the same no matter how the user set up tmux.
+const serverConfig = `# Written by claude-squad for its own tmux server. Changes are overwritten.
+set -g status off
+set -g mouse off
+set -g history-limit 10000
+set -g default-terminal "screen-256color"
+set -s escape-time 0
+`
+
+// ServerArgs returns the arguments selecting the tmux server claude-squad runs its sessions on, e.g. for
+// `tmux -L claudesquad ls`. It is the socket configured with tmux_socket, started with its own config file.
+// tmux_socket can't be set in project config files, so every process finds the sessions on the same server.
+var ServerArgs = sync.OnceValue(func() []string {
+	args := SocketArgs(config.LoadConfig().TmuxSocket)
+	path, err := writeServerConfig()
+	if err != nil {
+		log.WarningLog.Printf("starting the tmux server without its config: %v", err)
+		return args
+	}
+	return append(args, "-f", path)
+})
+
+// SocketArgs returns the tmux arguments selecting a socket, given either as a name in the tmux socket directory
+// or as a path.
+func SocketArgs(socket string) []string {
+	if strings.Contains(socket, "/") {
+		return []string{"-S", socket}
+	}
+	return []string{"-L", socket}
+}
+
+// writeServerConfig writes the config file of the tmux server unless it is up to date, and returns its path.
+func writeServerConfig() (string, error) {
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(configDir, ServerConfigFileName)
+	if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, []byte(serverConfig)) {
+		return path, nil
+	}
+	if err := config.WriteConfigFile(path, []byte(serverConfig)); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return path, nil
+}
+
+// serverCommand returns a tmux command run against the server of claude-squad.
+func serverCommand(args ...string) *exec.Cmd {
+	return exec.Command("tmux", append(slices.Clone(ServerArgs()), args...)...)
+}
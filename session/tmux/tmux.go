@@ -1,17 +1,17 @@
 package tmux
 
 import (
-	"bytes"
 	"claude-squad/cmd"
+	"claude-squad/config"
 	"claude-squad/log"
 	"context"
-	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -34,6 +34,18 @@ type TmuxSession struct {
 	ptyFactory PtyFactory
 	// cmdExec is used to execute commands in the tmux session.
 	cmdExec cmd.Executor
+	// server holds the arguments selecting the tmux server the session lives on, nil until it is known.
+	server []string
+	// companions are the extra windows of the session, see config.Companion.
+	companions []config.Companion
+	// record is set if the output of the program is recorded, see startRecording.
+	record bool
+	// onDefaultServer is set for sessions which were created on the user's default tmux server, before
+	// claude-squad had a server of its own.
+	onDefaultServer bool
+	// control returns the control mode client which tells the monitor when the pane printed something. The
+	// monitor captures the pane on every check if it is nil or returns nil.
+	control func(cmdExec cmd.Executor) *controlClient
 
 	// Initialized by Start or Restore
 	//
@@ -66,9 +78,15 @@ func toClaudeSquadTmuxName(str string) string {
 	return fmt.Sprintf("%s%s", TmuxPrefix, str)
 }
 
-// NewTmuxSession creates a new TmuxSession with the given name and program.
-func NewTmuxSession(name string, program string) *TmuxSession {
-	return newTmuxSession(name, program, MakePtyFactory(), cmd.MakeExecutor())
+// NewTmuxSession creates a new TmuxSession with the given name and program. Its companions come from the
+// config of the repository at repoPath.
+func NewTmuxSession(name string, program string, repoPath string) *TmuxSession {
+	t := newTmuxSession(name, program, MakePtyFactory(), cmd.MakeExecutor())
+	t.control = sharedControlClient
+	cfg := config.LoadConfigFor(repoPath)
+	t.companions = cfg.Companions
+	t.record = cfg.RecordSessions
+	return t
 }
 
 func newTmuxSession(name string, program string, ptyFactory PtyFactory, cmdExec cmd.Executor) *TmuxSession {
@@ -83,19 +101,32 @@ func newTmuxSession(name string, program string, ptyFactory PtyFactory, cmdExec
 // Start creates and starts a new tmux session, then attaches to it. Program is the command to run in
 // the session (ex. claude). workdir is the git worktree directory.
 func (t *TmuxSession) Start(workDir string) error {
+	// New sessions always go on the server of claude-squad.
+	t.server = ServerArgs()
+	t.onDefaultServer = false
+
 	// Check if the session already exists
 	if t.DoesSessionExist() {
 		return fmt.Errorf("tmux session already exists: %s", t.sanitizedName)
 	}
 
 	// Create a new detached tmux session and start claude in it
-	cmd := exec.Command("tmux", "new-session", "-d", "-s", t.sanitizedName, "-c", workDir, t.program)
+	args := []string{"new-session", "-d", "-s", t.sanitizedName, "-n", config.AgentWindowName, "-c", workDir, t.program}
+	if t.record {
+		// Piping in the same command list records the output from the start.
+		if recordingArgs, err := t.recordingArgs(); err != nil {
+			log.ErrorLog.Printf("could not record session %s: %v", t.sanitizedName, err)
+		} else {
+			args = append(append(args, ";"), recordingArgs...)
+		}
+	}
+	cmd := t.command(args...)
 
 	ptmx, err := t.ptyFactory.Start(cmd)
 	if err != nil {
 		// Cleanup any partially created session if any exists.
 		if t.DoesSessionExist() {
-			cleanupCmd := exec.Command("tmux", "kill-session", "-t", t.sanitizedName)
+			cleanupCmd := t.command("kill-session", "-t", t.sanitizedName)
 			if cleanupErr := t.cmdExec.Run(cleanupCmd); cleanupErr != nil {
 				err = fmt.Errorf("%v (cleanup error: %v)", err, cleanupErr)
 			}
@@ -120,6 +151,8 @@ func (t *TmuxSession) Start(workDir string) error {
 	}
 	ptmx.Close()
 
+	t.startCompanions()
+
 	err = t.Restore()
 	if err != nil {
 		if cleanupErr := t.Close(); cleanupErr != nil {
@@ -155,34 +188,68 @@ func (t *TmuxSession) Start(workDir string) error {
 	return nil
 }
 
+// command returns a tmux command run against the server the session lives on.
+func (t *TmuxSession) command(args ...string) *exec.Cmd {
+	return exec.Command("tmux", append(t.serverArgs(), args...)...)
+}
+
+// serverArgs returns the arguments selecting the server the session lives on. Sessions which were created on
+// the user's default server before claude-squad had its own stay there until they are killed.
+func (t *TmuxSession) serverArgs() []string {
+	if t.server == nil {
+		t.server = ServerArgs()
+		name := fmt.Sprintf("-t=%s", t.sanitizedName)
+		onServer := t.cmdExec.Run(exec.Command("tmux", append(slices.Clone(t.server), "has-session", name)...)) == nil
+		if !onServer && t.cmdExec.Run(exec.Command("tmux", "has-session", name)) == nil {
+			log.InfoLog.Printf("session %s is on the default tmux server", t.sanitizedName)
+			t.server = []string{}
+			t.onDefaultServer = true
+		}
+	}
+	return slices.Clone(t.server)
+}
+
 // Restore attaches to an existing session and restores the window size
 func (t *TmuxSession) Restore() error {
-	ptmx, err := t.ptyFactory.Start(exec.Command("tmux", "attach-session", "-t", t.sanitizedName))
+	ptmx, err := t.ptyFactory.Start(t.command("attach-session", "-t", t.sanitizedName))
 	if err != nil {
 		return fmt.Errorf("error opening PTY: %w", err)
 	}
 	t.ptmx = ptmx
 	t.monitor = newStatusMonitor()
+	if t.record {
+		if err := t.startRecording(); err != nil {
+			log.ErrorLog.Printf("could not record session %s: %v", t.sanitizedName, err)
+		}
+	}
 	return nil
 }
 
+// statusMonitor remembers what the pane looked like when it was last checked. With a control mode client,
+// the pane is only captured again after it printed something.
 type statusMonitor struct {
-	// Store hashes to save memory.
-	prevOutputHash []byte
+	// checked is false until the pane was captured for the status for the first time.
+	checked bool
+	// statusOutputs, previewOutputs and scrollbackOutputs are the output counts of the pane when the status,
+	// the preview and the scrollback were last captured.
+	statusOutputs     uint64
+	previewOutputs    uint64
+	scrollbackOutputs uint64
+	// content is the content of the pane when the status was last captured.
+	content   string
+	hasPrompt bool
+	// preview is the cached preview content, valid if previewValid is set.
+	preview      string
+	previewValid bool
+	// scrollback is the cached content of the pane including its history, valid if scrollbackValid is set.
+	scrollback      string
+	scrollbackValid bool
 }
 
 func newStatusMonitor() *statusMonitor {
 	return &statusMonitor{}
 }
 
-// hash hashes the string.
-func (m *statusMonitor) hash(s string) []byte {
-	h := sha256.New()
-	// TODO: this allocation sucks since the string is probably large. Ideally, we hash the string directly.
-	h.Write([]byte(s))
-	return h.Sum(nil)
-}
-
 // TapEnter sends an enter keystroke to the tmux pane.
 func (t *TmuxSession) TapEnter() error {
 	_, err := t.ptmx.Write([]byte{0x0D})
@@ -209,6 +276,13 @@ func (t *TmuxSession) SendKeys(keys string) error {
 // HasUpdated checks if the tmux pane content has changed since the last tick. It also returns true if
 // the tmux pane has a prompt for aider or claude code.
 func (t *TmuxSession) HasUpdated() (updated bool, hasPrompt bool) {
+	monitor := t.statusMonitor()
+	outputs, watched := t.outputCount()
+	if watched && monitor.checked && outputs == monitor.statusOutputs {
+		// Nothing was printed, so neither the content nor the prompt changed.
+		return false, monitor.hasPrompt
+	}
+
 	content, err := t.CapturePaneContent()
 	if err != nil {
 		log.ErrorLog.Printf("error capturing pane content in status monitor: %v", err)
@@ -222,11 +296,77 @@ func (t *TmuxSession) HasUpdated() (updated bool, hasPrompt bool) {
 		hasPrompt = strings.Contains(content, "(Y)es/(N)o/(D)on't ask again")
 	}
 
-	if !bytes.Equal(t.monitor.hash(content), t.monitor.prevOutputHash) {
-		t.monitor.prevOutputHash = t.monitor.hash(content)
-		return true, hasPrompt
+	// Output which doesn't change the content, like redrawing the same screen, doesn't count as an update.
+	updated = !monitor.checked || content != monitor.content
+	monitor.checked = true
+	monitor.statusOutputs = outputs
+	monitor.content = content
+	monitor.hasPrompt = hasPrompt
+	return updated, hasPrompt
+}
+
+// Preview returns the content of the pane like CapturePaneContent. With a control mode client, the content
+// is only captured again after the pane printed something or was resized.
+func (t *TmuxSession) Preview() (string, error) {
+	monitor := t.statusMonitor()
+	outputs, watched := t.outputCount()
+	if watched && monitor.previewValid && outputs == monitor.previewOutputs {
+		return monitor.preview, nil
+	}
+	content, err := t.CapturePaneContent()
+	if err != nil {
+		return "", err
+	}
+	monitor.preview = content
+	monitor.previewOutputs = outputs
+	monitor.previewValid = true
+	return content, nil
+}
+
+// PreviewScrollback returns the content of the pane including its whole history, cached like Preview.
+func (t *TmuxSession) PreviewScrollback() (string, error) {
+	monitor := t.statusMonitor()
+	outputs, watched := t.outputCount()
+	if watched && monitor.scrollbackValid && outputs == monitor.scrollbackOutputs {
+		return monitor.scrollback, nil
+	}
+	content, err := t.CapturePaneContentWithOptions("-", "-")
+	if err != nil {
+		return "", err
+	}
+	monitor.scrollback = content
+	monitor.scrollbackOutputs = outputs
+	monitor.scrollbackValid = true
+	return content, nil
+}
+
+// statusMonitor returns the monitor of the session. Sessions which were never restored (e.g. detached
+// instances) don't have one yet.
+func (t *TmuxSession) statusMonitor() *statusMonitor {
+	if t.monitor == nil {
+		t.monitor = newStatusMonitor()
+	}
+	return t.monitor
+}
+
+// outputCount returns how often the pane printed something according to the control mode client. It returns
+// false if there is no client or it can't watch the pane.
+func (t *TmuxSession) outputCount() (uint64, bool) {
+	// The control mode client only sees the server of claude-squad.
+	t.serverArgs()
+	if t.control == nil || t.onDefaultServer {
+		return 0, false
+	}
+	client := t.control(t.cmdExec)
+	if client == nil {
+		return 0, false
 	}
-	return false, hasPrompt
+	count, err := client.outputCount(t.sanitizedName)
+	if err != nil {
+		log.WarningLog.Printf("could not watch tmux session: %v", err)
+		return 0, false
+	}
+	return count, true
 }
 
 func (t *TmuxSession) Attach() (chan struct{}, error) {
@@ -317,6 +457,9 @@ func (t *TmuxSession) Detach() {
 		log.ErrorLog.Println(msg)
 		panic(msg)
 	}
+	// Keys are sent to the window shown, which has to be the program's again.
+	t.selectAgentWindow()
+
 	// Attach goroutines should die on EOF due to the ptmx closing. Call
 	// t.Restore to set a new t.ptmx.
 	if err = t.Restore(); err != nil {
@@ -331,6 +474,20 @@ func (t *TmuxSession) Detach() {
 	t.wg.Wait()
 }
 
+// Disconnect closes the PTY attached to the session without killing the session. Input can't be sent
+// to the session until it's restored again.
+func (t *TmuxSession) Disconnect() error {
+	if t.ptmx == nil {
+		return nil
+	}
+	err := t.ptmx.Close()
+	t.ptmx = nil
+	if err != nil {
+		return fmt.Errorf("error closing PTY: %w", err)
+	}
+	return nil
+}
+
 // Close terminates the tmux session and cleans up resources
 func (t *TmuxSession) Close() error {
 	var errs []error
@@ -342,7 +499,13 @@ func (t *TmuxSession) Close() error {
 		t.ptmx = nil
 	}
 
-	cmd := exec.Command("tmux", "kill-session", "-t", t.sanitizedName)
+	// Unlink the window from the monitor session first, otherwise it would outlive the session.
+	if t.control != nil && !t.onDefaultServer {
+		if client := runningControlClient(); client != nil {
+			client.unwatch(t.sanitizedName)
+		}
+	}
+	cmd := t.command("kill-session", "-t", t.sanitizedName)
 	if err := t.cmdExec.Run(cmd); err != nil {
 		errs = append(errs, fmt.Errorf("error killing tmux session: %w", err))
 	}
@@ -364,6 +527,9 @@ func (t *TmuxSession) Close() error {
 // SetDetachedSize set the width and height of the session while detached. This makes the
 // tmux output conform to the specified shape.
 func (t *TmuxSession) SetDetachedSize(width, height int) error {
+	// Resizing rewraps the content without the pane printing anything.
+	t.statusMonitor().previewValid = false
+	t.statusMonitor().scrollbackValid = false
 	return t.updateWindowSize(width, height)
 }
 
@@ -379,14 +545,14 @@ func (t *TmuxSession) updateWindowSize(cols, rows int) error {
 
 func (t *TmuxSession) DoesSessionExist() bool {
 	// Using "-t name" does a prefix match, which is wrong. `-t=` does an exact match.
-	existsCmd := exec.Command("tmux", "has-session", fmt.Sprintf("-t=%s", t.sanitizedName))
+	existsCmd := t.command("has-session", fmt.Sprintf("-t=%s", t.sanitizedName))
 	return t.cmdExec.Run(existsCmd) == nil
 }
 
 // CapturePaneContent captures the content of the tmux pane
 func (t *TmuxSession) CapturePaneContent() (string, error) {
 	// Add -e flag to preserve escape sequences (ANSI color codes)
-	cmd := exec.Command("tmux", "capture-pane", "-p", "-e", "-J", "-t", t.sanitizedName)
+	cmd := t.command("capture-pane", "-p", "-e", "-J", "-t", t.agentTarget())
 	output, err := t.cmdExec.Output(cmd)
 	if err != nil {
 		return "", fmt.Errorf("error capturing pane content: %v", err)
@@ -398,7 +564,7 @@ func (t *TmuxSession) CapturePaneContent() (string, error) {
 // start and end specify the starting and ending line numbers (use "-" for the start/end of history)
 func (t *TmuxSession) CapturePaneContentWithOptions(start, end string) (string, error) {
 	// Add -e flag to preserve escape sequences (ANSI color codes)
-	cmd := exec.Command("tmux", "capture-pane", "-p", "-e", "-J", "-S", start, "-E", end, "-t", t.sanitizedName)
+	cmd := t.command("capture-pane", "-p", "-e", "-J", "-S", start, "-E", end, "-t", t.agentTarget())
 	output, err := t.cmdExec.Output(cmd)
 	if err != nil {
 		return "", fmt.Errorf("failed to capture tmux pane content with options: %v", err)
@@ -406,32 +572,54 @@ func (t *TmuxSession) CapturePaneContentWithOptions(start, end string) (string,
 	return string(output), nil
 }
 
-// CleanupSessions kills all tmux sessions that start with "session-"
-func CleanupSessions(cmdExec cmd.Executor) error {
-	// First try to list sessions
-	cmd := exec.Command("tmux", "ls")
-	output, err := cmdExec.Output(cmd)
+// CapturePaneTextWithOptions is like CapturePaneContentWithOptions but strips escape sequences, leaving
+// plain text.
+func (t *TmuxSession) CapturePaneTextWithOptions(start, end string) (string, error) {
+	cmd := t.command("capture-pane", "-p", "-J", "-S", start, "-E", end, "-t", t.agentTarget())
+	output, err := t.cmdExec.Output(cmd)
+	if err != nil {
+		return "", fmt.Errorf("failed to capture tmux pane text with options: %v", err)
+	}
+	return string(output), nil
+}
 
-	// If there's an error and it's because no server is running, that's fine
-	// Exit code 1 typically means no sessions exist
+// HistoryAndCursor returns the number of lines in the pane's history, excluding the visible screen, and the
+// row of the cursor on the visible screen.
+func (t *TmuxSession) HistoryAndCursor() (history int, cursorY int, err error) {
+	cmd := t.command("display-message", "-p", "-t", t.agentTarget(), "#{history_size} #{cursor_y}")
+	output, err := t.cmdExec.Output(cmd)
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
-			return nil // No sessions to clean up
-		}
-		return fmt.Errorf("failed to list tmux sessions: %v", err)
+		return 0, 0, fmt.Errorf("failed to get tmux history size: %v", err)
 	}
+	if _, err := fmt.Sscanf(string(output), "%d %d", &history, &cursorY); err != nil {
+		return 0, 0, fmt.Errorf("failed to parse tmux history size and cursor %q: %v", output, err)
+	}
+	return history, cursorY, nil
+}
 
-	re := regexp.MustCompile(fmt.Sprintf(`%s.*:`, TmuxPrefix))
-	matches := re.FindAllString(string(output), -1)
-	for i, match := range matches {
-		matches[i] = match[:strings.Index(match, ":")]
+// CleanupSessions kills the server of claude-squad along with all of its sessions. Instances created before
+// claude-squad had its own server may still run on the user's default server, so the sessions of the instances
+// with the given IDs are killed there too. Other sessions are never touched.
+func CleanupSessions(cmdExec cmd.Executor, ids []string) error {
+	if err := cmdExec.Run(serverCommand("kill-server")); err != nil && !isNoServer(err) {
+		return fmt.Errorf("failed to kill tmux server: %v", err)
 	}
 
-	for _, match := range matches {
-		log.InfoLog.Printf("cleaning up session: %s", match)
-		if err := cmdExec.Run(exec.Command("tmux", "kill-session", "-t", match)); err != nil {
-			return fmt.Errorf("failed to kill tmux session %s: %v", match, err)
+	for _, id := range ids {
+		name := toClaudeSquadTmuxName(id)
+		if cmdExec.Run(exec.Command("tmux", "has-session", "-t="+name)) != nil {
+			continue
+		}
+		log.InfoLog.Printf("cleaning up session on the default tmux server: %s", name)
+		if err := cmdExec.Run(exec.Command("tmux", "kill-session", "-t", "="+name)); err != nil {
+			return fmt.Errorf("failed to kill tmux session %s: %v", name, err)
 		}
 	}
 	return nil
 }
+
+// isNoServer returns whether a tmux command failed with exit code 1, which it does if no server is running.
+func isNoServer(err error) bool {
+	exitErr, ok := err.(*exec.ExitError)
+	return ok && exitErr.ExitCode() == 1
+}
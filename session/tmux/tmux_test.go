@@ -2,6 +2,8 @@ package tmux
 
 import (
 	cmd2 "claude-squad/cmd"
+	"claude-squad/config"
+	"claude-squad/log"
 	"fmt"
 	"math/rand"
 	"os"
@@ -41,11 +43,30 @@ func NewMockPtyFactory(t *testing.T) *MockPtyFactory {
 	}
 }
 
+func TestMain(m *testing.M) {
+	// The server arguments come from the config, keep the tests away from the real one.
+	home, err := os.MkdirTemp("", "tmux-test-home")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("HOME", home)
+	log.Initialize(false)
+	code := m.Run()
+	log.Close()
+	os.RemoveAll(home)
+	os.Exit(code)
+}
+
+// tmuxString returns how a tmux command with args run against the server of claude-squad is printed.
+func tmuxString(args string) string {
+	return "tmux " + strings.Join(ServerArgs(), " ") + " " + args
+}
+
 func TestSanitizeName(t *testing.T) {
-	session := NewTmuxSession("asdf", "program")
+	session := NewTmuxSession("asdf", "program", ".")
 	require.Equal(t, TmuxPrefix+"asdf", session.sanitizedName)
 
-	session = NewTmuxSession("a sd f . . asdf", "program")
+	session = NewTmuxSession("a sd f . . asdf", "program", ".")
 	require.Equal(t, TmuxPrefix+"asdf__asdf", session.sanitizedName)
 }
 
@@ -72,9 +93,9 @@ func TestStartTmuxSession(t *testing.T) {
 	err := session.Start(workdir)
 	require.NoError(t, err)
 	require.Equal(t, 2, len(ptyFactory.cmds))
-	require.Equal(t, fmt.Sprintf("tmux new-session -d -s claudesquad_test-session -c %s claude", workdir),
+	require.Equal(t, tmuxString(fmt.Sprintf("new-session -d -s claudesquad_test-session -n agent -c %s claude", workdir)),
 		cmd2.ToString(ptyFactory.cmds[0]))
-	require.Equal(t, "tmux attach-session -t claudesquad_test-session",
+	require.Equal(t, tmuxString("attach-session -t claudesquad_test-session"),
 		cmd2.ToString(ptyFactory.cmds[1]))
 
 	require.Equal(t, 2, len(ptyFactory.files))
@@ -86,3 +107,177 @@ func TestStartTmuxSession(t *testing.T) {
 	_, err = ptyFactory.files[1].Stat()
 	require.NoError(t, err)
 }
+
+func TestCleanupSessionsKillsLegacySessions(t *testing.T) {
+	var ran []string
+	cmdExec := cmd_test.MockCmdExec{
+		RunFunc: func(cmd *exec.Cmd) error {
+			ran = append(ran, cmd2.ToString(cmd))
+			// Only the session of the first instance is on the default server.
+			if cmd2.ToString(cmd) == "tmux has-session -t="+TmuxPrefix+"gone" {
+				return fmt.Errorf("can't find session")
+			}
+			return nil
+		},
+	}
+
+	require.NoError(t, CleanupSessions(cmdExec, []string{"0123456789ab", "gone"}))
+	require.Equal(t, []string{
+		tmuxString("kill-server"),
+		"tmux has-session -t=" + TmuxPrefix + "0123456789ab",
+		"tmux kill-session -t =" + TmuxPrefix + "0123456789ab",
+		"tmux has-session -t=" + TmuxPrefix + "gone",
+	}, ran)
+}
+
+func TestPaneFollower(t *testing.T) {
+	var f PaneFollower
+	// Lines on the visible screen are returned up to the cursor.
+	require.Equal(t, []string{"a", "b"}, f.Next([]string{"a", "b", "$ typ"}, 0, 2))
+	require.Nil(t, f.Next([]string{"a", "b", "$ typing"}, 0, 2))
+	require.Equal(t, []string{"$ typing", "c"}, f.Next([]string{"a", "b", "$ typing", "c", "$"}, 0, 4))
+
+	// At the history limit, tmux drops the oldest lines while new ones scroll in.
+	require.Equal(t, []string{"$", "d"}, f.Next([]string{"a", "b", "$ typing", "c", "$", "d", "$"}, 3, 3))
+	require.Equal(t, []string{"e", "f"}, f.Next([]string{"$ typing", "c", "$", "d", "e", "f", "$"}, 4, 2))
+
+	// Once the history is cleared, everything left is new.
+	require.Equal(t, []string{"g"}, f.Next([]string{"g", "$"}, 0, 1))
+}
+
+func TestSocketArgs(t *testing.T) {
+	require.Equal(t, []string{"-L", "claudesquad"}, SocketArgs("claudesquad"))
+	require.Equal(t, []string{"-S", "/run/user/1000/cs.sock"}, SocketArgs("/run/user/1000/cs.sock"))
+}
+
+func TestParseNotification(t *testing.T) {
+	name, args := parseNotification(`%output %12 hello\015\012`)
+	require.Equal(t, "%output", name)
+	require.Equal(t, `%12 hello\015\012`, args)
+
+	name, _ = parseNotification("%sessions-changed")
+	require.Equal(t, "%sessions-changed", name)
+
+	// Output of commands isn't a notification.
+	name, _ = parseNotification("claudesquad_test-session: 1 windows")
+	require.Empty(t, name)
+}
+
+func TestHasUpdatedCapturesOnlyAfterOutput(t *testing.T) {
+	captures := 0
+	cmdExec := cmd_test.MockCmdExec{
+		RunFunc: func(cmd *exec.Cmd) error {
+			return nil
+		},
+		OutputFunc: func(cmd *exec.Cmd) ([]byte, error) {
+			if strings.Contains(cmd.String(), "capture-pane") {
+				captures++
+				return []byte(fmt.Sprintf("screen %d", captures)), nil
+			}
+			return []byte("@1 %1"), nil
+		},
+	}
+	client := &controlClient{
+		cmdExec: cmdExec,
+		session: MonitorSessionPrefix + "test",
+		watched: make(map[string]watchedPane),
+		outputs: make(map[string]uint64),
+		done:    make(chan struct{}),
+	}
+	session := newTmuxSession("test-session", "claude", NewMockPtyFactory(t), cmdExec)
+	session.control = func(cmd2.Executor) *controlClient { return client }
+
+	updated, _ := session.HasUpdated()
+	require.True(t, updated)
+	require.Equal(t, 1, captures)
+
+	// Without output, the pane isn't captured again.
+	updated, _ = session.HasUpdated()
+	require.False(t, updated)
+	preview, err := session.Preview()
+	require.NoError(t, err)
+	require.Equal(t, "screen 2", preview)
+	preview, err = session.Preview()
+	require.NoError(t, err)
+	require.Equal(t, "screen 2", preview)
+	require.Equal(t, 2, captures)
+
+	client.outputs["%1"]++
+	updated, _ = session.HasUpdated()
+	require.True(t, updated)
+	preview, err = session.Preview()
+	require.NoError(t, err)
+	require.Equal(t, "screen 4", preview)
+	require.Equal(t, 4, captures)
+}
+
+func TestCompanions(t *testing.T) {
+	var ran []string
+	cmdExec := cmd_test.MockCmdExec{
+		RunFunc: func(cmd *exec.Cmd) error {
+			ran = append(ran, cmd2.ToString(cmd))
+			return nil
+		},
+		OutputFunc: func(cmd *exec.Cmd) ([]byte, error) {
+			if strings.Contains(cmd.String(), "list-windows") {
+				return []byte("agent\nshell\n"), nil
+			}
+			return nil, fmt.Errorf("can't find window")
+		},
+	}
+	session := newTmuxSession("test-session", "claude", NewMockPtyFactory(t), cmdExec)
+	session.server = ServerArgs()
+	session.companions = []config.Companion{{Name: "shell"}, {Name: "tests", Command: "go test ./..."}}
+
+	require.Equal(t, []string{"shell", "tests"}, session.Companions())
+	session.startCompanions()
+	require.Equal(t, []string{
+		tmuxString("new-window -d -t =claudesquad_test-session: -n shell -c #{session_path}"),
+		tmuxString("new-window -d -t =claudesquad_test-session: -n tests -c #{session_path} go test ./..."),
+	}, ran)
+
+	// The capture fails for windows which aren't there, e.g. because their command exited.
+	_, err := session.CaptureWindow("tests")
+	require.ErrorIs(t, err, ErrWindowNotRunning)
+	_, err = session.CaptureWindow("shell")
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrWindowNotRunning)
+}
+
+func TestPreviewScrollbackCapturesHistoryOnlyAfterOutput(t *testing.T) {
+	var captures []string
+	cmdExec := cmd_test.MockCmdExec{
+		RunFunc: func(cmd *exec.Cmd) error {
+			return nil
+		},
+		OutputFunc: func(cmd *exec.Cmd) ([]byte, error) {
+			if strings.Contains(cmd.String(), "capture-pane") {
+				captures = append(captures, cmd2.ToString(cmd))
+				return []byte("history\nscreen"), nil
+			}
+			return []byte("@1 %1"), nil
+		},
+	}
+	client := &controlClient{
+		cmdExec: cmdExec,
+		session: MonitorSessionPrefix + "test",
+		watched: make(map[string]watchedPane),
+		outputs: make(map[string]uint64),
+		done:    make(chan struct{}),
+	}
+	session := newTmuxSession("test-session", "claude", NewMockPtyFactory(t), cmdExec)
+	session.server = ServerArgs()
+	session.control = func(cmd2.Executor) *controlClient { return client }
+
+	for range 2 {
+		content, err := session.PreviewScrollback()
+		require.NoError(t, err)
+		require.Equal(t, "history\nscreen", content)
+	}
+	require.Equal(t, []string{tmuxString("capture-pane -p -e -J -S - -E - -t =claudesquad_test-session:^")}, captures)
+
+	client.outputs["%1"]++
+	_, err := session.PreviewScrollback()
+	require.NoError(t, err)
+	require.Len(t, captures, 2)
+}
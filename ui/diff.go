@@ -108,6 +108,26 @@ func (d *DiffPane) ScrollDown() {
 	d.viewport.LineDown(1)
 }
 
+// PageUp scrolls the viewport a page up
+func (d *DiffPane) PageUp() {
+	d.viewport.ViewUp()
+}
+
+// PageDown scrolls the viewport a page down
+func (d *DiffPane) PageDown() {
+	d.viewport.ViewDown()
+}
+
+// GotoTop jumps to the top of the viewport
+func (d *DiffPane) GotoTop() {
+	d.viewport.GotoTop()
+}
+
+// GotoBottom jumps to the bottom of the viewport
+func (d *DiffPane) GotoBottom() {
+	d.viewport.GotoBottom()
+}
+
 func colorizeDiff(diff string) string {
 	var coloredOutput strings.Builder
 
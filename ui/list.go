@@ -13,6 +13,7 @@ import (
 
 const readyIcon = "● "
 const pausedIcon = "⏸ "
+const lostIcon = "✗ "
 
 var readyStyle = lipgloss.NewStyle().
 	Foreground(lipgloss.AdaptiveColor{Light: "#51bd73", Dark: "#51bd73"})
@@ -26,6 +27,9 @@ var removedLinesStyle = lipgloss.NewStyle().
 var pausedStyle = lipgloss.NewStyle().
 	Foreground(lipgloss.AdaptiveColor{Light: "#888888", Dark: "#888888"})
 
+var lostStyle = lipgloss.NewStyle().
+	Foreground(lipgloss.Color("#de613e"))
+
 var titleStyle = lipgloss.NewStyle().
 	Padding(1, 1, 0, 1).
 	Foreground(lipgloss.AdaptiveColor{Light: "#1a1a1a", Dark: "#dddddd"})
@@ -62,6 +66,8 @@ type List struct {
 	// map of repo name to number of instances using it. Used to display the repo name only if there are
 	// multiple repos in play.
 	repos map[string]int
+	// scope describes which instances are listed, e.g. the name of the repo. It is shown in the title.
+	scope string
 }
 
 func NewList(spinner *spinner.Model, autoYes bool) *List {
@@ -84,7 +90,7 @@ func (l *List) SetSize(width, height int) {
 // width and height.
 func (l *List) SetSessionPreviewSize(width, height int) (err error) {
 	for i, item := range l.items {
-		if !item.Started() || item.Paused() {
+		if !item.Started() || item.Paused() || item.Lost() {
 			continue
 		}
 
@@ -134,6 +140,8 @@ func (r *InstanceRenderer) Render(i *session.Instance, idx int, selected bool, h
 		join = readyStyle.Render(readyIcon)
 	case session.Paused:
 		join = pausedStyle.Render(pausedIcon)
+	case session.Lost:
+		join = lostStyle.Render(lostIcon)
 	default:
 	}
 
@@ -222,8 +230,16 @@ func (r *InstanceRenderer) Render(i *session.Instance, idx int, selected bool, h
 	return text
 }
 
+// SetScope sets the description of which instances are listed, which is shown in the title.
+func (l *List) SetScope(scope string) {
+	l.scope = scope
+}
+
 func (l *List) String() string {
-	const titleText = " Instances "
+	titleText := " Instances "
+	if l.scope != "" {
+		titleText = fmt.Sprintf(" Instances: %s ", l.scope)
+	}
 	const autoYesText = " auto-yes "
 
 	// Write the title.
@@ -281,21 +297,37 @@ func (l *List) Kill() {
 		log.ErrorLog.Printf("could not kill instance: %v", err)
 	}
 
-	// If you delete the last one in the list, select the previous one.
-	if l.selectedIdx == len(l.items)-1 {
+	l.Remove(targetInstance)
+}
+
+// Remove removes an instance from the list without killing it.
+func (l *List) Remove(instance *session.Instance) {
+	idx := -1
+	for i, item := range l.items {
+		if item == instance {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		return
+	}
+
+	// If you delete the selected item and it's the last one in the list, select the previous one. If
+	// an item before the selected one is deleted, keep the same item selected.
+	if idx < l.selectedIdx || (idx == l.selectedIdx && idx == len(l.items)-1) {
 		defer l.Up()
 	}
 
 	// Unregister the reponame.
-	repoName, err := targetInstance.RepoName()
+	repoName, err := instance.RepoName()
 	if err != nil {
 		log.ErrorLog.Printf("could not get repo name: %v", err)
 	} else {
 		l.rmRepo(repoName)
 	}
 
-	// Since there's items after this, the selectedIdx can stay the same.
-	l.items = append(l.items[:l.selectedIdx], l.items[l.selectedIdx+1:]...)
+	l.items = append(l.items[:idx], l.items[idx+1:]...)
 }
 
 func (l *List) Attach() (chan struct{}, error) {
@@ -126,9 +126,13 @@ func (m *Menu) addInstanceOptions() {
 
 	// Action group
 	actionGroup := []keys.KeyName{keys.KeyEnter, keys.KeySubmit}
-	if m.instance.Status == session.Paused {
+	switch m.instance.Status {
+	case session.Paused:
 		actionGroup = append(actionGroup, keys.KeyResume)
-	} else {
+	case session.Lost:
+		// Lost instances can't be attached to, pushed or paused until they are repaired.
+		actionGroup = []keys.KeyName{keys.KeyRepair, keys.KeyRename}
+	default:
 		actionGroup = append(actionGroup, keys.KeyCheckout)
 	}
 
@@ -139,6 +143,9 @@ func (m *Menu) addInstanceOptions() {
 
 	// System group
 	systemGroup := []keys.KeyName{keys.KeyTab, keys.KeyHelp, keys.KeyQuit}
+	if len(m.instance.Windows()) > 1 && !m.isInDiffTab {
+		systemGroup = []keys.KeyName{keys.KeyTab, keys.KeyWindow, keys.KeyHelp, keys.KeyQuit}
+	}
 
 	// Combine all groups
 	options = append(options, actionGroup...)
@@ -161,9 +168,9 @@ func (m *Menu) String() string {
 		start int
 		end   int
 	}{
-		{0, 2}, // Instance management group (n, d)
-		{2, 5}, // Action group (enter, submit, pause/resume)
-		{6, 8}, // System group (tab, help, q)
+		{0, 2},              // Instance management group (n, d)
+		{2, 5},              // Action group (enter, submit, pause/resume)
+		{5, len(m.options)}, // System group (tab, window, help, q)
 	}
 
 	for i, k := range m.options {
@@ -2,20 +2,36 @@ package ui
 
 import (
 	"claude-squad/session"
+	"claude-squad/session/tmux"
+	"errors"
 	"fmt"
 	"strings"
 
+	"github.com/charmbracelet/bubbles/viewport"
 	"github.com/charmbracelet/lipgloss"
 )
 
 var previewPaneStyle = lipgloss.NewStyle().
 	Foreground(lipgloss.AdaptiveColor{Light: "#1a1a1a", Dark: "#dddddd"})
 
+var scrollStatusStyle = lipgloss.NewStyle().
+	Foreground(lipgloss.AdaptiveColor{Light: "#7A7474", Dark: "#9C9494"})
+
 type PreviewPane struct {
 	width  int
 	height int
 
 	previewState previewState
+
+	// scrolling is true in scroll mode, which shows the whole history of the window in viewport instead of
+	// its screen.
+	scrolling bool
+	// follow keeps the viewport at the end of the history while the window prints more.
+	follow   bool
+	viewport viewport.Model
+	// instance and window are the instance and window shown. Selecting others ends scroll mode.
+	instance *session.Instance
+	window   string
 }
 
 type previewState struct {
@@ -26,16 +42,22 @@ type previewState struct {
 }
 
 func NewPreviewPane() *PreviewPane {
-	return &PreviewPane{}
+	return &PreviewPane{
+		viewport: viewport.New(0, 0),
+	}
 }
 
 func (p *PreviewPane) SetSize(width, maxHeight int) {
 	p.width = width
 	p.height = maxHeight
+	// The last line shows where the viewport is in the history.
+	p.viewport.Width = width
+	p.viewport.Height = max(maxHeight-1, 0)
 }
 
 // setFallbackState sets the preview state with fallback text and a message
 func (p *PreviewPane) setFallbackState(message string) {
+	p.scrolling = false
 	p.previewState = previewState{
 		fallback: true,
 		text:     lipgloss.JoinVertical(lipgloss.Center, FallBackText, "", message),
@@ -44,6 +66,16 @@ func (p *PreviewPane) setFallbackState(message string) {
 
 // Updates the preview pane content with the tmux pane content
 func (p *PreviewPane) UpdateContent(instance *session.Instance) error {
+	window := ""
+	if instance != nil {
+		window = instance.PreviewWindow()
+	}
+	if instance != p.instance || window != p.window {
+		p.scrolling = false
+	}
+	p.instance = instance
+	p.window = window
+
 	switch {
 	case instance == nil:
 		p.setFallbackState("No agents running yet. Spin up a new instance with 'n' to get started!")
@@ -63,9 +95,26 @@ func (p *PreviewPane) UpdateContent(instance *session.Instance) error {
 				)),
 		))
 		return nil
+	case instance.Status == session.Lost:
+		p.setFallbackState(lipgloss.JoinVertical(lipgloss.Center,
+			"Session is lost. Press 'enter' to repair it.",
+			"",
+			lipgloss.NewStyle().
+				Foreground(lipgloss.Color("#de613e")).
+				Render(instance.LostReason),
+		))
+		return nil
+	}
+
+	if p.scrolling {
+		return p.updateScrollback(instance)
 	}
 
 	content, err := instance.Preview()
+	if errors.Is(err, tmux.ErrWindowNotRunning) {
+		p.setFallbackState(fmt.Sprintf("%s is not running. Press 'enter' to start it.", instance.PreviewWindow()))
+		return nil
+	}
 	if err != nil {
 		return err
 	}
@@ -82,12 +131,134 @@ func (p *PreviewPane) UpdateContent(instance *session.Instance) error {
 	return nil
 }
 
+// updateScrollback loads the whole history of the window into the viewport.
+func (p *PreviewPane) updateScrollback(instance *session.Instance) error {
+	content, err := instance.PreviewScrollback()
+	if errors.Is(err, tmux.ErrWindowNotRunning) {
+		p.setFallbackState(fmt.Sprintf("%s is not running. Press 'enter' to start it.", instance.PreviewWindow()))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// The screen below the cursor is empty, there is nothing to scroll to.
+	p.viewport.SetContent(strings.TrimRight(content, "\n"))
+	if p.follow {
+		p.viewport.GotoBottom()
+	}
+	return nil
+}
+
+// startScrolling switches to scroll mode, starting at the end of the history where the screen was. It returns
+// false if there is nothing to scroll through.
+func (p *PreviewPane) startScrolling() (bool, error) {
+	if p.scrolling {
+		return true, nil
+	}
+	if p.instance == nil || p.previewState.fallback {
+		return false, nil
+	}
+	p.scrolling = true
+	p.follow = false
+	if err := p.updateScrollback(p.instance); err != nil {
+		p.scrolling = false
+		return false, err
+	}
+	p.viewport.GotoBottom()
+	return p.scrolling, nil
+}
+
+// ScrollUp scrolls one line up, switching to scroll mode.
+func (p *PreviewPane) ScrollUp() error {
+	if ok, err := p.startScrolling(); !ok {
+		return err
+	}
+	p.follow = false
+	p.viewport.LineUp(1)
+	return nil
+}
+
+// ScrollDown scrolls one line down in scroll mode.
+func (p *PreviewPane) ScrollDown() {
+	if p.scrolling {
+		p.viewport.LineDown(1)
+	}
+}
+
+// PageUp scrolls a page up, switching to scroll mode.
+func (p *PreviewPane) PageUp() error {
+	if ok, err := p.startScrolling(); !ok {
+		return err
+	}
+	p.follow = false
+	p.viewport.ViewUp()
+	return nil
+}
+
+// PageDown scrolls a page down in scroll mode.
+func (p *PreviewPane) PageDown() {
+	if p.scrolling {
+		p.viewport.ViewDown()
+	}
+}
+
+// GotoTop jumps to the start of the history, switching to scroll mode.
+func (p *PreviewPane) GotoTop() error {
+	if ok, err := p.startScrolling(); !ok {
+		return err
+	}
+	p.follow = false
+	p.viewport.GotoTop()
+	return nil
+}
+
+// GotoBottom jumps to the end of the history in scroll mode.
+func (p *PreviewPane) GotoBottom() {
+	if p.scrolling {
+		p.viewport.GotoBottom()
+	}
+}
+
+// ToggleFollow toggles whether the viewport follows the end of the history, switching to scroll mode.
+func (p *PreviewPane) ToggleFollow() error {
+	if ok, err := p.startScrolling(); !ok {
+		return err
+	}
+	p.follow = !p.follow
+	if p.follow {
+		p.viewport.GotoBottom()
+	}
+	return nil
+}
+
+// StopScrolling leaves scroll mode, showing the screen of the window again.
+func (p *PreviewPane) StopScrolling() {
+	p.scrolling = false
+}
+
+// IsScrolling returns true in scroll mode.
+func (p *PreviewPane) IsScrolling() bool {
+	return p.scrolling
+}
+
 // Returns the preview pane content as a string.
 func (p *PreviewPane) String() string {
 	if p.width == 0 || p.height == 0 {
 		return strings.Repeat("\n", p.height)
 	}
 
+	if p.scrolling {
+		first := min(p.viewport.YOffset+1, p.viewport.TotalLineCount())
+		last := p.viewport.YOffset + p.viewport.VisibleLineCount()
+		follow := "f follow"
+		if p.follow {
+			follow = "f stop following"
+		}
+		status := scrollStatusStyle.Render(fmt.Sprintf("lines %d-%d of %d • %s • esc back to screen",
+			first, last, p.viewport.TotalLineCount(), follow))
+		return previewPaneStyle.Width(p.width).Render(lipgloss.JoinVertical(lipgloss.Left, p.viewport.View(), status))
+	}
+
 	if p.previewState.fallback {
 		// Calculate available height for fallback text
 		availableHeight := p.height - 3 - 4 // 2 for borders, 1 for margin, 1 for padding
@@ -1,6 +1,7 @@
 package ui
 
 import (
+	"claude-squad/config"
 	"claude-squad/session"
 
 	"github.com/charmbracelet/lipgloss"
@@ -95,6 +96,11 @@ func (w *TabbedWindow) Toggle() {
 
 // UpdatePreview updates the content of the preview pane. instance may be nil.
 func (w *TabbedWindow) UpdatePreview(instance *session.Instance) error {
+	// The tab names the companion window shown instead of the program.
+	w.tabs[PreviewTab] = "Preview"
+	if instance != nil && instance.PreviewWindow() != config.AgentWindowName {
+		w.tabs[PreviewTab] = "Preview · " + instance.PreviewWindow()
+	}
 	if w.activeTab != PreviewTab {
 		return nil
 	}
@@ -108,17 +114,76 @@ func (w *TabbedWindow) UpdateDiff(instance *session.Instance) {
 	w.diff.SetDiff(instance)
 }
 
-// Add these new methods for handling scroll events
-func (w *TabbedWindow) ScrollUp() {
-	if w.activeTab == 1 { // Diff tab
+// ScrollUp scrolls the active tab one line up. Scrolling the preview switches it to scroll mode, which shows the
+// history of the window.
+func (w *TabbedWindow) ScrollUp() error {
+	if w.activeTab == DiffTab {
 		w.diff.ScrollUp()
+		return nil
 	}
+	return w.preview.ScrollUp()
 }
 
 func (w *TabbedWindow) ScrollDown() {
-	if w.activeTab == 1 { // Diff tab
+	if w.activeTab == DiffTab {
 		w.diff.ScrollDown()
+		return
+	}
+	w.preview.ScrollDown()
+}
+
+// PageUp scrolls the active tab a page up.
+func (w *TabbedWindow) PageUp() error {
+	if w.activeTab == DiffTab {
+		w.diff.PageUp()
+		return nil
+	}
+	return w.preview.PageUp()
+}
+
+// PageDown scrolls the active tab a page down.
+func (w *TabbedWindow) PageDown() {
+	if w.activeTab == DiffTab {
+		w.diff.PageDown()
+		return
+	}
+	w.preview.PageDown()
+}
+
+// GotoTop jumps to the top of the active tab.
+func (w *TabbedWindow) GotoTop() error {
+	if w.activeTab == DiffTab {
+		w.diff.GotoTop()
+		return nil
+	}
+	return w.preview.GotoTop()
+}
+
+// GotoBottom jumps to the bottom of the active tab.
+func (w *TabbedWindow) GotoBottom() {
+	if w.activeTab == DiffTab {
+		w.diff.GotoBottom()
+		return
+	}
+	w.preview.GotoBottom()
+}
+
+// ToggleFollow toggles whether the preview follows the end of the history.
+func (w *TabbedWindow) ToggleFollow() error {
+	if w.activeTab != PreviewTab {
+		return nil
 	}
+	return w.preview.ToggleFollow()
+}
+
+// StopScrolling shows the screen of the window in the preview again.
+func (w *TabbedWindow) StopScrolling() {
+	w.preview.StopScrolling()
+}
+
+// IsScrollingPreview returns true if the preview shows the history of the window.
+func (w *TabbedWindow) IsScrollingPreview() bool {
+	return w.activeTab == PreviewTab && w.preview.IsScrolling()
 }
 
 // IsInDiffTab returns true if the diff tab is currently active
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"claude-squad/api"
+	"claude-squad/log"
+	"claude-squad/session"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// watchPollInterval is how often instances are polled when no TUI or daemon is running.
+const watchPollInterval = 500 * time.Millisecond
+
+// errNoServer is returned when nobody is serving the control API.
+var errNoServer = errors.New("control API is not being served")
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Stream instance events as newline delimited JSON",
+	Long: "Print one JSON object per line whenever an instance is created or killed, changes status, starts " +
+		"asking for approval or changes its diff stats. Events come from the running TUI or daemon; when " +
+		"neither is running, instances are polled directly.",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		log.Initialize(false)
+		defer log.CloseSilently()
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		encoder := json.NewEncoder(os.Stdout)
+		for ctx.Err() == nil {
+			err := streamEvents(ctx)
+			if err != nil && !errors.Is(err, errNoServer) {
+				return err
+			}
+			if err := pollEvents(ctx, encoder); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// streamEvents copies the event stream of the control API to stdout until it ends.
+func streamEvents(ctx context.Context) error {
+	path, err := api.SocketPath()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://cs/v1/events", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := api.NewHTTPClient(path).Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("%w: %v", errNoServer, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: unexpected status %s", errNoServer, resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if _, err := fmt.Println(scanner.Text()); err != nil {
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	// The host went away. Keep watching by polling.
+	return fmt.Errorf("%w: event stream ended", errNoServer)
+}
+
+// pollEvents polls stored instances and their tmux sessions, printing events, until the control API is
+// served again or ctx is done.
+func pollEvents(ctx context.Context, encoder *json.Encoder) error {
+	socketPath, err := api.SocketPath()
+	if err != nil {
+		return err
+	}
+	tracker := api.NewEventTracker()
+	instances := make(map[string]*session.Instance)
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+	for {
+		storage, err := loadStorage()
+		if err != nil {
+			return err
+		}
+		instancesData, err := storage.LoadInstanceData()
+		if err != nil {
+			return err
+		}
+
+		observations := make([]api.Observation, 0, len(instancesData))
+		seen := make(map[string]*session.Instance, len(instancesData))
+		for _, data := range instancesData {
+			instance, ok := instances[data.ID]
+			if !ok {
+				instance = session.FromInstanceDataDetached(data)
+			}
+			seen[data.ID] = instance
+			instance.Title = data.Title
+			if data.Status == session.Paused || data.Status == session.Lost {
+				instance.SetStatus(data.Status)
+				observations = append(observations, api.Observation{Instance: instance})
+				continue
+			}
+
+			updated, prompt := instance.HasUpdated()
+			if updated {
+				instance.SetStatus(session.Running)
+			} else if !prompt {
+				instance.SetStatus(session.Ready)
+			}
+			if err := instance.UpdateDiffStats(); err != nil {
+				log.WarningLog.Printf("could not update diff stats for %s: %v", data.Title, err)
+			}
+			observations = append(observations, api.Observation{Instance: instance, Prompt: prompt})
+		}
+		instances = seen
+
+		for _, event := range tracker.Observe(observations) {
+			if err := encoder.Encode(event); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		// Prefer the events of a TUI or daemon which started in the meantime.
+		if conn, err := net.DialTimeout("unix", socketPath, time.Second); err == nil {
+			conn.Close()
+			return nil
+		}
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+}